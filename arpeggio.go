@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+type Arpeggio uint8
+
+const (
+	Block   Arpeggio = iota // every note struck together
+	Up                      // from the bass to the top
+	Down                    // from the top to the bass
+	UpDown                  // up then back down without repeating the ends
+	Alberti                 // bass, top, middle, top
+	Broken                  // in the order the hash gives
+)
+
+// ArpeggioFor lets the hash choose how the chords are rendered
+func ArpeggioFor(hash string) Arpeggio {
+	hash = strings.TrimLeft(hash, "0")
+	if len(hash) < 3 {
+		return Block
+	}
+	return Arpeggio(hash[2] % 6)
+}
+
+// Order returns the index of the chord note sounding at every step of the
+// arpeggio
+func (a Arpeggio) Order(notes, steps int, hash string) []int {
+	order := make([]int, steps)
+	if notes == 0 {
+		return order
+	}
+	for s := range order {
+		switch a {
+		case Up:
+			order[s] = s % notes
+		case Down:
+			order[s] = notes - 1 - s%notes
+		case UpDown:
+			cycle := 2*notes - 2
+			if cycle <= 0 {
+				break
+			}
+			if k := s % cycle; k < notes {
+				order[s] = k
+			} else {
+				order[s] = cycle - k
+			}
+		case Alberti:
+			order[s] = []int{0, notes - 1, notes / 2, notes - 1}[s%4]
+		case Broken:
+			if len(hash) > 0 {
+				order[s] = int(hash[s%len(hash)]) % notes
+			}
+		}
+	}
+	return order
+}
+
+// arpeggiate plays the notes of the chord one after the other in quavers, or
+// halves of the length when it is shorter than a crotchet, the last one lasting
+// until the end of the length
+func (m *Melody) arpeggiate(wr *writer.SMF, c *Chord, length uint32) {
+	step := wr.MetricTicks.Ticks4th() / 2
+	if length < 2*step {
+		step = length / 2
+	}
+	if step == 0 {
+		step = length
+	}
+	steps := int(length / step)
+
+	hash := strings.TrimLeft(m.Hash, "0")
+	for s, i := range m.Arpeggio.Order(len(c.Notes), steps, hash) {
+		n := c.Notes[i]
+		ticks := step
+		if s == steps-1 {
+			ticks = length - step*uint32(steps-1)
+		}
+		velocity := n.Velocity
+		if m.HarmonyHumanize != nil {
+			velocity = m.HarmonyHumanize.velocity(velocity)
+		}
+		writer.NoteOn(wr, uint8(n.GetNoteTone()), uint8(velocity))
+		m.forward(wr, m.press(wr, ticks))
+		writer.NoteOff(wr, uint8(n.GetNoteTone()))
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+func TestArpeggioOrder(t *testing.T) {
+	for a, want := range map[Arpeggio][]int{
+		Block:   {0, 0, 0, 0, 0, 0},
+		Up:      {0, 1, 2, 0, 1, 2},
+		Down:    {2, 1, 0, 2, 1, 0},
+		UpDown:  {0, 1, 2, 1, 0, 1},
+		Alberti: {0, 2, 1, 2, 0, 2},
+		Broken:  {1, 2, 0, 1, 2, 0},
+	} {
+		if order := a.Order(3, 6, "123"); !reflect.DeepEqual(order, want) {
+			t.Errorf("Arpeggio %d expected %v, got %v", a, want, order)
+		}
+	}
+}
+
+func TestArpeggiateKeepsLength(t *testing.T) {
+	var buf bytes.Buffer
+	wr := writer.NewSMF(&buf, 1)
+	m := &Melody{Scale: C, Mode: Ionian, Hash: "9", Arpeggio: Up, TimeSignature: &TimeSignature{Numerator: 4, Denominator: 4}}
+	minim := NoteDuration(Minim).Ticks(wr)
+
+	for _, length := range []uint32{minim, minim / 4, minim * 3 / 4} {
+		start := wr.Position()
+		m.arpeggiate(wr, m.Chord(I, nil, Minim), length)
+		if played := wr.Position() - start; played != uint64(length) {
+			t.Errorf("Arpeggio expected to last %d ticks, got %d", length, played)
+		}
+	}
+}
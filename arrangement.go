@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+// MIDI channels, numbered from zero
+const midiChannels = 16
+
+// Part is a track of the song played on a channel of its own
+type Part struct {
+	Name    string
+	Channel uint8
+	Drums   bool
+	Mix     *Mix // the controllers are left to the player when missing
+	Build   func(wr *writer.SMF) error
+}
+
+// Arrangement lays the song out as a format 1 file: a conductor track with
+// the title, tempo, meters and section markers, then a track per part
+type Arrangement struct {
+	Song  *Song
+	Title string
+	Tempo float64
+	Parts []*Part
+}
+
+func NewArrangement(song *Song, title string, tempo float64) *Arrangement {
+	return &Arrangement{Song: song, Title: title, Tempo: tempo}
+}
+
+// Add gives the part the first channel no other part plays on, the drum
+// channel aside
+func (a *Arrangement) Add(name string, build func(wr *writer.SMF) error) (*Part, error) {
+	used := make(map[uint8]bool)
+	for _, p := range a.Parts {
+		used[p.Channel] = true
+	}
+	for ch := uint8(0); ch < midiChannels; ch++ {
+		if ch != drumChannel && !used[ch] {
+			return a.Assign(name, ch, build)
+		}
+	}
+	return nil, fmt.Errorf("no channel left for part %q", name)
+}
+
+// AddDrums puts the part on the General MIDI percussion channel
+func (a *Arrangement) AddDrums(name string, build func(wr *writer.SMF) error) (*Part, error) {
+	p := &Part{Name: name, Channel: drumChannel, Drums: true, Build: build}
+	if err := p.checkAgainst(a.Parts); err != nil {
+		return nil, err
+	}
+	a.Parts = append(a.Parts, p)
+	return p, nil
+}
+
+// Assign puts the part on the channel given
+func (a *Arrangement) Assign(name string, channel uint8, build func(wr *writer.SMF) error) (*Part, error) {
+	p := &Part{Name: name, Channel: channel, Build: build}
+	if err := p.checkAgainst(a.Parts); err != nil {
+		return nil, err
+	}
+	a.Parts = append(a.Parts, p)
+	return p, nil
+}
+
+// check tells whether the part is on a channel that exists and that it may
+// play on
+func (p *Part) check() error {
+	if p.Channel >= midiChannels {
+		return fmt.Errorf("part %q on channel %d, there are only %d", p.Name, p.Channel+1, midiChannels)
+	}
+	if p.Drums != (p.Channel == drumChannel) {
+		return fmt.Errorf("part %q on channel %d, reserved to the drums", p.Name, p.Channel+1)
+	}
+	return nil
+}
+
+// checkAgainst tells whether the part may play along the others, on a channel
+// none of them is on
+func (p *Part) checkAgainst(others []*Part) error {
+	if err := p.check(); err != nil {
+		return err
+	}
+	for _, other := range others {
+		if other.Channel == p.Channel {
+			return fmt.Errorf("parts %q and %q both on channel %d", other.Name, p.Name, p.Channel+1)
+		}
+	}
+	return nil
+}
+
+// Validate checks no two parts share a channel and only the drums play on
+// theirs
+func (a *Arrangement) Validate() error {
+	for i, p := range a.Parts {
+		if err := p.checkAgainst(a.Parts[:i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tracks counts the conductor track and the track of every part
+func (a *Arrangement) Tracks() uint16 {
+	return uint16(len(a.Parts)) + 1
+}
+
+// Write writes the conductor track then every part on its channel, with the
+// instrument of the part. The arrangement is expected to be valid.
+func (a *Arrangement) Write(wr *writer.SMF) error {
+	writer.TrackSequenceName(wr, a.Title)
+	writer.TempoBPM(wr, a.Tempo)
+	a.Song.BuildConductor(wr)
+	writer.EndOfTrack(wr)
+
+	for _, p := range a.Parts {
+		wr.SetChannel(p.Channel)
+		writer.TrackSequenceName(wr, p.Name)
+		if err := a.Song.SelectPatch(wr, p.Name); err != nil {
+			return err
+		}
+		if p.Mix != nil {
+			p.Mix.Apply(wr)
+		}
+		if err := p.Build(wr); err != nil {
+			return err
+		}
+		writer.EndOfTrack(wr)
+	}
+	return nil
+}
+
+// WriteFile validates the arrangement and writes it as a Standard MIDI File
+func (a *Arrangement) WriteFile(path string) error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+	return writer.WriteSMF(path, a.Tracks(), a.Write)
+}
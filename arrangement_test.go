@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+func TestArrangementChannels(t *testing.T) {
+	a := NewArrangement(&Song{}, "title", 120)
+	build := func(wr *writer.SMF) error { return nil }
+
+	for i := 0; i < 9; i++ {
+		if _, err := a.Add("Part", build); err != nil {
+			t.Fatalf("Part %d expected a channel, got %v", i, err)
+		}
+	}
+	p, err := a.Add("Tenth", build)
+	if err != nil || p.Channel != 10 {
+		t.Errorf("Tenth part expected to skip the drum channel, got %+v (%v)", p, err)
+	}
+	if d, err := a.AddDrums("Percussions", build); err != nil || d.Channel != drumChannel {
+		t.Errorf("Drums expected on the tenth channel, got %+v (%v)", d, err)
+	}
+	if _, err := a.AddDrums("More percussions", build); err == nil {
+		t.Errorf("Second drum part expected to collide")
+	}
+	if _, err := a.Assign("Lead", 2, build); err == nil {
+		t.Errorf("Part on a used channel expected to collide")
+	}
+	if _, err := a.Assign("Lead", drumChannel, build); err == nil {
+		t.Errorf("Melodic part expected to be refused the drum channel")
+	}
+
+	for i := 0; i < 5; i++ {
+		a.Add("Part", build)
+	}
+	if _, err := a.Add("Seventeenth", build); err == nil {
+		t.Errorf("Parts expected to run out of channels")
+	}
+	if err := a.Validate(); err != nil {
+		t.Errorf("Arrangement expected to be valid, got %v", err)
+	}
+	if tracks := a.Tracks(); tracks != 17 {
+		t.Errorf("Expected a conductor track and 16 parts, got %d tracks", tracks)
+	}
+
+	a.Parts[1].Channel = a.Parts[0].Channel
+	if err := a.Validate(); err == nil {
+		t.Errorf("Parts sharing a channel expected to be invalid")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+type Articulation uint8
+
+const (
+	Normal Articulation = iota
+	Staccato
+	Legato
+	Tenuto
+	Marcato
+)
+
+// ticks a legato note keeps sounding over the next one
+const legatoOverlap uint32 = 30
+
+// Shape returns how long the articulation sounds a note of the length given
+// and the velocity it strikes it with
+func (a Articulation) Shape(length uint32, velocity int32) (uint32, int32) {
+	switch a {
+	case Staccato:
+		return length / 2, velocity
+	case Tenuto:
+		return length, clampVelocity(velocity + 4)
+	case Marcato:
+		return length * 3 / 4, clampVelocity(velocity + 20)
+	}
+	return length, velocity
+}
+
+// Articulate marks the notes from their place in the phrase and the hash:
+// phrases close tenuto, repeated notes are detached, short steps are slurred
+// and the hash e stresses its note marcato
+func (m *Melody) Articulate(wr *writer.SMF) {
+	hash := strings.TrimLeft(m.Hash, "0")
+	if len(hash) == 0 {
+		return
+	}
+
+	phraseTicks := phraseMeasures * m.TimeSignature.MeasureTicks(wr)
+	position := uint32(0)
+	for i, n := range m.Notes {
+		ticks := n.Duration.Ticks(wr)
+		position += ticks
+		if n.Note == Rest {
+			continue
+		}
+
+		var next *Note
+		if i+1 < len(m.Notes) {
+			next = m.Notes[i+1]
+		}
+
+		switch {
+		case next == nil || position/phraseTicks != (position-ticks)/phraseTicks:
+			n.Articulation = Tenuto
+		case hash[i%len(hash)] == 'e':
+			n.Articulation = Marcato
+		case next.Note != Rest && next.GetNoteTone() == n.GetNoteTone():
+			n.Articulation = Staccato
+		case next.Note != Rest && ticks <= wr.MetricTicks.Ticks4th() && abs(int32(m.Step(next)-m.Step(n))) == 1:
+			n.Articulation = Legato
+		case ticks < wr.MetricTicks.Ticks4th() && hash[i%len(hash)] <= '2':
+			n.Articulation = Staccato
+		}
+	}
+}
+
+// sound strikes the note for the length given, nudged and articulated. A
+// legato note is held until the next one sounds.
+func (m *Melody) sound(wr *writer.SMF, n *Note, length uint32) {
+	delay, sound, cut := uint32(0), length, uint32(0)
+	velocity := n.Velocity
+	if m.Humanize != nil {
+		delay, sound, cut = m.Humanize.nudge(length)
+		velocity = m.Humanize.velocity(velocity)
+	}
+	articulated, velocity := n.Articulation.Shape(sound, velocity)
+	cut += sound - articulated
+	if n.Articulation == Legato {
+		articulated, cut = articulated+cut, 0
+	}
+
+	if m.held != nil && m.held.GetNoteTone() == n.GetNoteTone() {
+		m.release(wr)
+	}
+	m.forward(wr, delay)
+	writer.NoteOn(wr, uint8(n.GetNoteTone()), uint8(velocity))
+	if m.held != nil {
+		overlap := legatoOverlap
+		if overlap > articulated/2 {
+			overlap = articulated / 2
+		}
+		m.forward(wr, overlap)
+		m.release(wr)
+		articulated -= overlap
+	}
+
+	m.forward(wr, articulated)
+	if n.Articulation == Legato {
+		m.held = n
+		return
+	}
+	writer.NoteOff(wr, uint8(n.GetNoteTone()))
+	m.forward(wr, cut)
+}
+
+// release ends the legato note still held
+func (m *Melody) release(wr *writer.SMF) {
+	if m.held == nil {
+		return
+	}
+	writer.NoteOff(wr, uint8(m.held.GetNoteTone()))
+	m.held = nil
+}
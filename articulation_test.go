@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+func TestArticulationShape(t *testing.T) {
+	for a, want := range map[Articulation][2]int32{
+		Normal:   {960, 80},
+		Staccato: {480, 80},
+		Legato:   {960, 80},
+		Tenuto:   {960, 84},
+		Marcato:  {720, 100},
+	} {
+		if length, velocity := a.Shape(960, 80); int32(length) != want[0] || velocity != want[1] {
+			t.Errorf("Articulation %d expected to sound %d at %d, got %d at %d", a, want[0], want[1], length, velocity)
+		}
+	}
+}
+
+func TestArticulate(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+
+	m := &Melody{Scale: C, Mode: Ionian, Hash: "9", TimeSignature: &TimeSignature{Numerator: 4, Denominator: 4}}
+	for _, step := range []int{35, 36, 36, 38} {
+		n := &Note{Velocity: 80, Duration: Crochtet}
+		n.Note, n.Tone = m.NoteAt(step)
+		m.Notes = append(m.Notes, n)
+	}
+	m.Articulate(wr)
+
+	for i, want := range []Articulation{Legato, Staccato, Normal, Tenuto} {
+		if a := m.Notes[i].Articulation; a != want {
+			t.Errorf("Note %d expected articulation %d, got %d", i, want, a)
+		}
+	}
+}
+
+func TestLegatoKeepsGrid(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+
+	m := &Melody{}
+	for i := int32(0); i < 4; i++ {
+		m.play(wr, &Note{Note: C + i, Tone: 5, Velocity: 80, Duration: Crochtet, Articulation: Legato})
+	}
+	m.release(wr)
+	if want := uint64(4 * wr.MetricTicks.Ticks4th()); wr.Position() != want {
+		t.Errorf("Legato notes expected to end at %d, got %d", want, wr.Position())
+	}
+}
+
+func TestWriteMusicXMLArticulations(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+
+	m := &Melody{Scale: F, Mode: Ionian, Hash: "9", Ties: true, TimeSignature: &TimeSignature{Numerator: 4, Denominator: 4}}
+	for _, step := range []int{35, 36, 36, 38, 38} {
+		n := &Note{Velocity: 80, Duration: Crochtet}
+		n.Note, n.Tone = m.NoteAt(step)
+		m.Notes = append(m.Notes, n)
+	}
+	m.Notes[3].Duration = Minim
+	m.Articulate(wr)
+	m.BuildMelody(wr)
+
+	var buf bytes.Buffer
+	song := &Song{Sections: []*Section{{Kind: Verse, Name: "Verse 1", Melody: m}}}
+	if err := song.WriteMusicXML(&buf, wr); err != nil {
+		t.Fatal(err)
+	}
+
+	score := buf.String()
+	for _, want := range []string{"<fifths>-1</fifths>", "<staccato>", "<tenuto>", `<slur type="start">`, `<tie type="start">`, "<words>Verse 1</words>", "<alter>-1</alter>"} {
+		if !strings.Contains(score, want) {
+			t.Errorf("Score expected to contain %s", want)
+		}
+	}
+}
+
+func TestWriteMusicXMLFollowsSong(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+
+	themes := Themes([]string{
+		"00000000000000000003efccdd987dd6d93ba18327eef8fd4b46d0de863eb14c",
+		"000000000000000000051f8864b8eddf483e7d2b941d626ecea1de70fa0bf551",
+		"0000000000000000000e760a04fc958a0631d47490b5f111d0d6aca418b9df17",
+	})
+	song := NewSong(wr, themes)
+	song.BuildMelody(wr)
+
+	var buf bytes.Buffer
+	if err := song.WriteMusicXML(&buf, wr); err != nil {
+		t.Fatal(err)
+	}
+	var score xmlScore
+	if err := xml.Unmarshal(buf.Bytes(), &score); err != nil {
+		t.Fatal(err)
+	}
+
+	// every section starts in the score where it starts in the melody track
+	starts := make(map[string]uint64)
+	position := uint64(0)
+	for _, measure := range score.Part.Measures {
+		if measure.Direction != nil {
+			starts[measure.Direction.Words] = position
+		}
+		for _, n := range measure.Notes {
+			position += uint64(n.Duration)
+		}
+	}
+	for _, section := range song.Sections {
+		if start, ok := starts[section.Name]; !ok || start != section.Start {
+			t.Errorf("%s expected to start at %d in the score, got %d", section.Name, section.Start, start)
+		}
+	}
+	if position != song.End {
+		t.Errorf("Score expected to end with the melody track at %d, got %d", song.End, position)
+	}
+}
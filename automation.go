@@ -0,0 +1,125 @@
+package main
+
+import (
+	"strings"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+// MIDI controllers the automation writes
+const (
+	ccSustain    uint8 = 64
+	ccExpression uint8 = 11
+	ccPan        uint8 = 10
+	ccReverb     uint8 = 91
+	ccChorus     uint8 = 93
+)
+
+// ticks the sustain pedal goes down after the chord it holds sounds, apart
+// enough from its lift for a synth not to merge both
+const pedalDelay uint32 = 30
+
+// expression the phrases of a voice swell from and to
+const (
+	phraseSwellLow  = 88
+	phraseSwellHigh = 120
+)
+
+// Mix places a part in the stereo field and sends it to the effects
+type Mix struct {
+	Pan    uint8 // 0 left, 64 centre, 127 right
+	Reverb uint8
+	Chorus uint8
+}
+
+// Apply sets the controllers of the mix on the channel of the track
+func (x *Mix) Apply(wr *writer.SMF) {
+	writer.ControlChange(wr, ccPan, x.Pan)
+	writer.ControlChange(wr, ccReverb, x.Reverb)
+	writer.ControlChange(wr, ccChorus, x.Chorus)
+}
+
+// sends of every role, before the hash moves them
+var roleMixes = map[string]Mix{
+	"melody":       {Pan: 64, Reverb: 48, Chorus: 8},
+	"harmony":      {Pan: 64, Reverb: 56, Chorus: 24},
+	"counterpoint": {Pan: 64, Reverb: 48, Chorus: 8},
+	"doubling":     {Pan: 64, Reverb: 56, Chorus: 16},
+	"bass":         {Pan: 64, Reverb: 16},
+	"pad":          {Pan: 64, Reverb: 96, Chorus: 48},
+	"drums":        {Pan: 64, Reverb: 32},
+}
+
+// MixFor spreads the parts from left to right in their order, the melody, the
+// bass and the drums staying in the centre, and lets the hash move the sends
+// of the role a little
+func MixFor(hash, role string, index, parts int) *Mix {
+	x := roleMixes[role]
+	hash = strings.TrimLeft(hash, "0")
+	jitter := 0
+	if len(hash) > 0 {
+		jitter = int(hash[index%len(hash)]%17) - 8
+	}
+
+	switch role {
+	case "melody", "bass", "drums":
+	default:
+		if parts > 1 {
+			x.Pan = uint8(16 + 96*index/(parts-1))
+		}
+		x.Pan = clampController(int(x.Pan) + jitter)
+	}
+	x.Reverb = clampController(int(x.Reverb) + jitter)
+	if x.Chorus > 0 {
+		x.Chorus = clampController(int(x.Chorus) + jitter)
+	}
+	return &x
+}
+
+func clampController(v int) uint8 {
+	if v < 0 {
+		return 0
+	}
+	if v > 127 {
+		return 127
+	}
+	return uint8(v)
+}
+
+// SustainFor lets the hash choose whether the harmony is pedalled
+func SustainFor(hash string) bool {
+	hash = strings.TrimLeft(hash, "0")
+	return len(hash) > 4 && hash[4]%2 == 0
+}
+
+// SwellFor lets the hash choose whether the phrases of a voice swell
+func SwellFor(hash string) bool {
+	hash = strings.TrimLeft(hash, "0")
+	return len(hash) > 5 && hash[5]%2 == 0
+}
+
+// lift raises the sustain pedal at a chord change, so the chord before stops
+// ringing
+func (m *Melody) lift(wr *writer.SMF) {
+	writer.ControlChange(wr, ccSustain, 0)
+	m.lifted = true
+}
+
+// press puts the sustain pedal down again shortly after the chord just struck
+// when it was lifted, and returns the ticks the chord still sounds
+func (m *Melody) press(wr *writer.SMF, ticks uint32) uint32 {
+	if !m.lifted || ticks <= pedalDelay {
+		return ticks
+	}
+	m.forward(wr, pedalDelay)
+	writer.ControlChange(wr, ccSustain, 127)
+	m.lifted = false
+	return ticks - pedalDelay
+}
+
+// swellPhrase sets the expression of the note starting at the position of the
+// track, rising to the middle of its phrase and falling back
+func (m *Melody) swellPhrase(wr *writer.SMF) {
+	period := phraseMeasures * m.TimeSignature.MeasureTicks(wr)
+	writer.ControlChange(wr, ccExpression, swellBetween(phraseSwellLow, phraseSwellHigh, m.grooved, period))
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"gitlab.com/gomidi/midi"
+	"gitlab.com/gomidi/midi/midimessage/channel"
+	"gitlab.com/gomidi/midi/reader"
+	"gitlab.com/gomidi/midi/writer"
+)
+
+func TestMixFor(t *testing.T) {
+	hash := "0003efccdd"
+
+	for _, role := range []string{"melody", "bass", "drums"} {
+		if x := MixFor(hash, role, 2, 5); x.Pan != 64 {
+			t.Errorf("%s expected in the centre, got pan %d", role, x.Pan)
+		}
+	}
+	left, right := MixFor(hash, "harmony", 0, 5), MixFor(hash, "pad", 4, 5)
+	if left.Pan >= 64 || right.Pan <= 64 {
+		t.Errorf("Parts expected to spread from left to right, got %d and %d", left.Pan, right.Pan)
+	}
+	if pad, bass := MixFor(hash, "pad", 1, 5), MixFor(hash, "bass", 1, 5); pad.Reverb <= bass.Reverb {
+		t.Errorf("Pad expected wetter than the bass, got %d and %d", pad.Reverb, bass.Reverb)
+	}
+	if x := MixFor(hash, "bass", 0, 1); x.Chorus != 0 {
+		t.Errorf("Bass expected without chorus, got %d", x.Chorus)
+	}
+}
+
+func TestProfileMix(t *testing.T) {
+	pan, reverb := uint8(0), uint8(127)
+	part := ProfilePart{Name: "Harp", Role: "harmony", Pan: &pan, Reverb: &reverb}
+	song := &Song{Sections: []*Section{{Melody: &Melody{Hash: "0003efccdd"}}}}
+
+	x := part.mix(song, 1, 3)
+	if x.Pan != 0 || x.Reverb != 127 {
+		t.Errorf("Declared controllers expected to be kept, got %+v", x)
+	}
+	if x.Chorus != MixFor("0003efccdd", "harmony", 1, 3).Chorus {
+		t.Errorf("Missing controllers expected from the hash, got %+v", x)
+	}
+
+	over := uint8(200)
+	p := &Profile{Name: "loud", Parts: []ProfilePart{{Name: "Lead", Role: "melody", Reverb: &over}}}
+	if err := p.Validate(); err == nil {
+		t.Errorf("Controller above 127 expected to be invalid")
+	}
+}
+
+func TestAutomationKeepsTime(t *testing.T) {
+	build := func(sustain, swell bool) uint64 {
+		wr := writer.NewSMF(io.Discard, 1)
+		m := &Melody{Scale: C, Mode: Ionian, Hash: "1", Sustain: sustain, Swell: swell, TimeSignature: &TimeSignature{Numerator: 4, Denominator: 4}}
+		for i := int32(0); i < 8; i++ {
+			m.Notes = append(m.Notes, &Note{Note: C + i%3, Tone: 5, Duration: Minim, Velocity: 80})
+		}
+		m.BuildMelody(wr)
+		m.BuildHarmony(wr)
+		return wr.Position()
+	}
+
+	if plain, automated := build(false, false), build(true, true); plain != automated {
+		t.Errorf("Pedal and swells expected to keep the notes in time, ended at %d instead of %d", automated, plain)
+	}
+}
+
+func TestPedalAtChordChanges(t *testing.T) {
+	var buf bytes.Buffer
+	wr := writer.NewSMF(&buf, 2)
+	m := &Melody{Scale: C, Mode: Ionian, Hash: "1", Sustain: true, TimeSignature: &TimeSignature{Numerator: 4, Denominator: 4}}
+	for i := int32(0); i < 4; i++ {
+		m.Notes = append(m.Notes, &Note{Note: C + i*2, Tone: 5, Duration: Semibreve, Velocity: 80})
+	}
+	m.BuildMelody(wr)
+	writer.EndOfTrack(wr)
+	m.BuildHarmony(wr)
+	writer.EndOfTrack(wr)
+
+	onsets, lifts, presses := map[uint64]bool{}, map[uint64]bool{}, []uint64{}
+	rd := reader.New(reader.NoLogger(), reader.Each(func(p *reader.Position, msg midi.Message) {
+		if p.Track != 1 {
+			return
+		}
+		switch msg := msg.(type) {
+		case channel.NoteOn:
+			if msg.Velocity() > 0 {
+				onsets[p.AbsoluteTicks] = true
+			}
+		case channel.ControlChange:
+			if msg.Controller() != ccSustain {
+				return
+			}
+			if msg.Value() == 0 {
+				lifts[p.AbsoluteTicks] = true
+			} else {
+				presses = append(presses, p.AbsoluteTicks)
+			}
+		}
+	}))
+	if err := reader.ReadSMF(rd, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(presses) == 0 {
+		t.Fatalf("Sustained harmony expected to press the pedal")
+	}
+	for _, tick := range presses {
+		if lifts[tick] {
+			t.Errorf("Pedal expected to be pressed apart from its lift, both at %d", tick)
+		}
+		if !onsets[tick-uint64(pedalDelay)] {
+			t.Errorf("Pedal at %d expected %d ticks after a chord", tick, pedalDelay)
+		}
+	}
+}
+
+func TestAutomationFromHash(t *testing.T) {
+	if !SustainFor("0003efc4") || SustainFor("0003efc5") {
+		t.Errorf("Even fifth character expected to pedal the harmony")
+	}
+	if !SwellFor("0003efcc8") || SwellFor("0003efcc9") {
+		t.Errorf("Even sixth character expected to swell the phrases")
+	}
+	if SustainFor("3ef") || SwellFor("3ef") {
+		t.Errorf("Short hashes expected without automation")
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"strings"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+type BassStyle uint8
+
+const (
+	RootBass      BassStyle = iota // the root for as long as the chord lasts
+	RootFifthBass                  // the root then the fifth
+	WalkingBass                    // a crotchet a beat through the chord to the next root
+	PedalBass                      // the tonic under every chord
+)
+
+// highest root of the bass, from E1 to G2 in the Bass range
+const bassHigh int32 = 43
+
+// BassStyleFor lets the hash choose how the bass plays
+func BassStyleFor(hash string) BassStyle {
+	hash = strings.TrimLeft(hash, "0")
+	if len(hash) < 2 {
+		return RootBass
+	}
+	return BassStyle(hash[1] % 4)
+}
+
+// BassTone places the root of the degree in the bass register
+func (m *Melody) BassTone(d Degree) int32 {
+	n, _ := m.ScaleStep(int(d))
+	tone := n%12 + 12*3
+	if tone > bassHigh {
+		tone -= 12
+	}
+	return tone + 12*m.Octaves
+}
+
+type bassNote struct {
+	tone  int32
+	ticks uint32
+}
+
+// bassLine plays the chord of the degree for the ticks given, the walking bass
+// leading to the root of the next one
+func (m *Melody) bassLine(wr *writer.SMF, d, next Degree, ticks uint32) []bassNote {
+	root := m.BassTone(d)
+	beat := wr.MetricTicks.Ticks4th() * 4 / uint32(m.TimeSignature.Denominator)
+	beats := ticks / beat
+
+	switch m.BassStyle {
+	case PedalBass:
+		return []bassNote{{m.BassTone(I), ticks}}
+	case RootFifthBass:
+		if beats < 2 {
+			break
+		}
+		half := beats / 2 * beat
+		return []bassNote{{root, half}, {root + m.Interval(d, 4), ticks - half}}
+	case WalkingBass:
+		if beats < 2 {
+			break
+		}
+		tones := []int32{root, root + m.Interval(d, 2), root + m.Interval(d, 4), root + m.Interval(d, 2)}
+		line := make([]bassNote, 0)
+		for b := uint32(0); b < beats-1; b++ {
+			line = append(line, bassNote{tones[b%uint32(len(tones))], beat})
+		}
+
+		// a semitone away from the next root, from the side the line comes
+		target := m.BassTone(next)
+		approach := target - 1
+		if line[len(line)-1].tone > target {
+			approach = target + 1
+		}
+		return append(line, bassNote{approach, ticks - (beats-1)*beat})
+	}
+	return []bassNote{{root, ticks}}
+}
+
+// BuildBass follows the degrees the harmony was built on, in the style of the
+// melody
+func (m *Melody) BuildBass(wr *writer.SMF) {
+	if m.Progression == nil {
+		m.Harmonize(wr)
+	}
+
+	type slot struct {
+		degree Degree
+		ticks  uint32
+	}
+	measureTicks := m.TimeSignature.MeasureTicks(wr)
+	slots := make([]slot, 0)
+	for i := uint8(1); i <= m.Measures; i++ {
+		if _, ok := m.Phrases[i]; !ok {
+			continue
+		}
+		degrees := m.Progression[i]
+		for s, d := range degrees {
+			from := measureTicks * uint32(s) / uint32(len(degrees))
+			to := measureTicks * uint32(s+1) / uint32(len(degrees))
+			slots = append(slots, slot{d, to - from})
+		}
+	}
+
+	position := uint32(0)
+	for k, sl := range slots {
+		next := Degree(I)
+		if k+1 < len(slots) {
+			next = slots[k+1].degree
+		}
+		for _, b := range m.bassLine(wr, sl.degree, next, sl.ticks) {
+			velocity := int32(100)
+			if m.Dynamics {
+				velocity = clampVelocity(phraseVelocity + m.TimeSignature.Accent(wr, position%measureTicks))
+			}
+			n, gap := Sustain(wr, b.tone%12, b.tone/12, velocity, b.ticks)
+			if n != nil {
+				n.Play(wr)
+			}
+			m.forward(wr, gap)
+			position += b.ticks
+		}
+	}
+}
+
+// BuildBass holds the root of every chord of the transition
+func (t *Transition) BuildBass(wr *writer.SMF) {
+	for _, c := range t.Chords {
+		root := c.Key.BassTone(c.Degree) + 12*t.To.Octaves
+		t.To.Hold(wr, root%12, root/12, t.To.HoldVelocity()).Play(wr)
+	}
+}
+
+// BuildBass follows the sections of the melody track, ending on the tonic
+func (s *Song) BuildBass(wr *writer.SMF) {
+	s.build(wr, (*Melody).BuildBass, (*Transition).BuildBass, func(last *Melody, wr *writer.SMF) {
+		tonic := last.BassTone(I)
+		last.Hold(wr, tonic%12, tonic/12, last.HoldVelocity()).Play(wr)
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+func TestBassTone(t *testing.T) {
+	m := &Melody{Scale: C, Mode: Ionian, TimeSignature: &TimeSignature{Numerator: 4, Denominator: 4}}
+
+	for d, want := range map[Degree]int32{I: 36, IV: 41, V: 43, VI: 33} {
+		if tone := m.BassTone(d); tone != want {
+			t.Errorf("Degree %d expected to give bass tone %d, got %d", d, want, tone)
+		}
+	}
+}
+
+func TestBassLineFillsChord(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+	m := &Melody{Scale: C, Mode: Ionian, TimeSignature: &TimeSignature{Numerator: 4, Denominator: 4}}
+	measure := m.TimeSignature.MeasureTicks(wr)
+
+	for _, style := range []BassStyle{RootBass, RootFifthBass, WalkingBass, PedalBass} {
+		m.BassStyle = style
+		line := m.bassLine(wr, IV, V, measure)
+		total := uint32(0)
+		for _, b := range line {
+			total += b.ticks
+		}
+		if total != measure {
+			t.Errorf("Style %d expected to last a measure, got %d ticks", style, total)
+		}
+
+		switch style {
+		case RootFifthBass:
+			if len(line) != 2 || line[1].tone-line[0].tone != 7 {
+				t.Errorf("Root and fifth expected, got %v", line)
+			}
+		case WalkingBass:
+			if last := line[len(line)-1].tone; abs(last-m.BassTone(V)) != 1 {
+				t.Errorf("Walking bass expected to approach the next root by a semitone, got %d", last)
+			}
+		case PedalBass:
+			if line[0].tone != m.BassTone(I) {
+				t.Errorf("Pedal expected on the tonic, got %d", line[0].tone)
+			}
+		}
+	}
+}
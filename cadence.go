@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+// scale steps of the chord each cadence lands on, where a phrase can rest
+var cadenceSteps = map[cadence][]int{
+	halfCadence:      {4, 6, 1},
+	authenticCadence: {0, 2, 4},
+	deceptiveCadence: {5, 0, 2},
+	finalCadence:     {0},
+}
+
+// Cadence moves the last note of every phrase to the nearest step of the chord
+// closing it, the last one to the tonic, keeping in the range given when a
+// step of the chord is in it
+func (m *Melody) Cadence(wr *writer.SMF, r Range) {
+	hash := strings.TrimLeft(m.Hash, "0")
+	if len(hash) == 0 {
+		hash = "0"
+	}
+
+	measureTicks := m.TimeSignature.MeasureTicks(wr)
+	last := make(map[int]*Note)
+	measures := 0
+	position := uint32(0)
+	for _, n := range m.Notes {
+		k := int(position / measureTicks)
+		position += n.Duration.Ticks(wr)
+		if n.Note != Rest {
+			last[k] = n
+			measures = k + 1
+		}
+	}
+
+	for k, n := range last {
+		steps, ok := cadenceSteps[cadenceOf(hash, k, measures)]
+		if !ok {
+			continue
+		}
+
+		from := m.Step(n)
+		best, distance := from, int32(-1)
+		for _, s := range steps {
+			for _, octave := range []int{-14, -7, 0, 7, 14} {
+				candidate := from - from%7 + s + octave
+				d := abs(int32(candidate - from))
+				if note, tone := m.NoteAt(candidate); note+12*tone < r.Low || note+12*tone > r.High {
+					d += 100
+				}
+				if distance < 0 || d < distance {
+					best, distance = candidate, d
+				}
+			}
+		}
+		note, tone := m.NoteAt(best)
+		pitch := note + 12*tone
+		n.Note, n.Tone = pitch%12, pitch/12
+	}
+}
+
+// FinalTone is the octave of the tonic nearest to the last note of the
+// melody, so the ending is held in its register
+func (m *Melody) FinalTone() int32 {
+	for i := len(m.Notes) - 1; i >= 0; i-- {
+		if n := m.Notes[i]; n.Note != Rest {
+			return (n.GetNoteTone() - m.Tonic() + 6) / 12
+		}
+	}
+	return 5
+}
+
+// Hold builds the notes lasting a measure, tied where one duration is not
+// enough
+func (m *Melody) Hold(wr *writer.SMF, note int32, tone int32, velocity int32) *Note {
+	head, _ := Sustain(wr, note, tone, velocity, m.TimeSignature.MeasureTicks(wr))
+	return head
+}
+
+// Sustain builds the notes lasting the ticks given, tied where one duration is
+// not enough, and returns the ticks no duration could express
+func Sustain(wr *writer.SMF, note int32, tone int32, velocity int32, ticks uint32) (*Note, uint32) {
+	fitted, gap := fitDurations(ticks, wr)
+
+	var head, last *Note
+	for _, d := range fitted {
+		n := &Note{Note: note, Tone: tone, Velocity: velocity, Duration: d, Tied: last != nil}
+		if last == nil {
+			head = n
+		} else {
+			last.Tie = n
+		}
+		last = n
+	}
+	return head, gap
+}
+
+// pad rests until the position given, writing the time still pending so the
+// position reached is exact
+func pad(wr *writer.SMF, position uint64) uint64 {
+	wr.Silence(int8(wr.Channel()), true)
+	if reached := wr.Position(); reached < position {
+		writer.Forward(wr, 0, uint32(position-reached), wr.MetricTicks.Ticks4th()*4)
+		wr.Silence(int8(wr.Channel()), true)
+	}
+	return wr.Position()
+}
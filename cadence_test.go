@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+func TestCadenceStableDegrees(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+
+	m := &Melody{Scale: C, Mode: Ionian, Hash: "1", TimeSignature: &TimeSignature{Numerator: 4, Denominator: 4}}
+	for i := 0; i < 16; i++ {
+		m.Notes = append(m.Notes, &Note{Note: m.Second(), Tone: 5, Duration: Minim})
+	}
+	m.Cadence(wr, InstrumentRanges["Lead"])
+
+	// first phrase closes on a half cadence, the piece on the tonic
+	if n := m.Notes[7]; n.Note != m.Second() {
+		t.Errorf("Second expected to rest on the dominant chord, got %d", n.Note)
+	}
+	if n := m.Notes[15]; n.GetNoteTone() != 60 {
+		t.Errorf("Melody expected to end on the tonic C5, got %d", n.GetNoteTone())
+	}
+	if n := m.Notes[14]; n.Note != m.Second() {
+		t.Errorf("Notes before the end of the phrase expected to stay, got %d", n.Note)
+	}
+}
+
+func TestCadenceKeepsRange(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+	r := Range{64, 96}
+
+	m := &Melody{Scale: C, Mode: Ionian, Hash: "1", TimeSignature: &TimeSignature{Numerator: 4, Denominator: 4}}
+	for i := 0; i < 16; i++ {
+		m.Notes = append(m.Notes, &Note{Note: m.Third(), Tone: 5, Duration: Minim})
+	}
+	m.Cadence(wr, r)
+
+	for i, n := range m.Notes {
+		if p := n.GetNoteTone(); p < r.Low || p > r.High {
+			t.Errorf("Note %d expected in range %v after the cadence, got %d", i, r, p)
+		}
+	}
+	if n := m.Notes[15]; n.GetNoteTone() != 72 {
+		t.Errorf("Melody expected to end on the tonic C6 above the range floor, got %d", n.GetNoteTone())
+	}
+	if tone := m.FinalTone(); tone != 6 {
+		t.Errorf("Ending expected to be held in the octave of the last note, got %d", tone)
+	}
+}
+
+func TestSongTracksAligned(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 2)
+
+	themes := Themes([]string{"00000000000000000003efccdd987dd6d93ba18327eef8fd4b46d0de863eb14c"})
+	for _, m := range themes {
+		m.Ties = true
+		m.Functional = true
+		m.Cadence(wr, InstrumentRanges["Lead"])
+	}
+	song := NewSong(wr, themes)
+
+	song.BuildMelody(wr)
+	writer.EndOfTrack(wr)
+
+	origin := wr.Position()
+	song.BuildHarmony(wr)
+	if end := wr.Position() - origin; end != song.End {
+		t.Errorf("Harmony expected to end with the melody at %d, got %d", song.End, end)
+	}
+
+	last := song.Sections[len(song.Sections)-1]
+	if want := last.End + uint64(last.Melody.TimeSignature.MeasureTicks(wr)); song.End != want {
+		t.Errorf("Song expected to end a measure after the last section at %d, got %d", want, song.End)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"strings"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+// scale steps below the cantus the counterpoint may sound: third, fifth,
+// sixth, octave, tenth and twelfth
+var counterpointSteps = []int{2, 4, 5, 7, 9, 11}
+
+func consonant(interval int32) bool {
+	switch abs(interval) % 12 {
+	case 0, 3, 4, 7, 8, 9:
+		return true
+	}
+	return false
+}
+
+func perfect(interval int32) bool {
+	i := abs(interval) % 12
+	return i == 0 || i == 7
+}
+
+// Counterpoint writes a second voice below the melody, note against note in
+// the range given. It starts and ends on perfect consonances, moves by step
+// and by contrary motion where it can, never by parallel fifths or octaves,
+// and fills the thirds it leaps on long notes with passing tones resolving by
+// step.
+func (m *Melody) Counterpoint(wr *writer.SMF, r Range) *Melody {
+	c := m.Clone()
+
+	hash := strings.TrimLeft(m.Hash, "0")
+	if len(hash) == 0 {
+		hash = "0"
+	}
+
+	cantus := make([]*Note, 0)
+	for _, n := range c.Notes {
+		if n.Note != Rest {
+			cantus = append(cantus, n)
+		}
+	}
+	if len(cantus) == 0 {
+		return c
+	}
+
+	candidates := make([][]int, len(cantus))
+	for i, n := range cantus {
+		for _, below := range counterpointSteps {
+			step := m.Step(n) - below
+			note, tone := m.NoteAt(step)
+			if consonant(n.GetNoteTone() - (note + 12*tone)) {
+				candidates[i] = append(candidates[i], step)
+			}
+		}
+	}
+
+	tone := func(step int) int32 {
+		note, octave := m.NoteAt(step)
+		return note + 12*octave
+	}
+
+	noteCost := func(i int, step int) float64 {
+		cost := 0.
+		t := tone(step)
+		interval := cantus[i].GetNoteTone() - t
+		if t < r.Low {
+			cost += 10 * float64(r.Low-t)
+		} else if t > r.High {
+			cost += 10 * float64(t-r.High)
+		}
+
+		switch {
+		case i == 0 && !perfect(interval):
+			cost += 10
+		case i == len(cantus)-1 && interval%12 != 0:
+			cost += 20
+		case i > 0 && i < len(cantus)-1 && perfect(interval):
+			cost++
+		}
+		return cost + 0.1*float64((int(hash[i%len(hash)])+step)%3)
+	}
+
+	motionCost := func(i int, from, to int) float64 {
+		cost := 0.
+		switch leap := abs(int32(to - from)); {
+		case leap == 0:
+			cost += 2
+		case leap == 2:
+			cost++
+		case leap > 2 && leap <= 4:
+			cost += 3
+		case leap > 4:
+			cost += 8
+		}
+
+		cantusMotion := cantus[i].GetNoteTone() - cantus[i-1].GetNoteTone()
+		motion := tone(to) - tone(from)
+		before := cantus[i-1].GetNoteTone() - tone(from)
+		after := cantus[i].GetNoteTone() - tone(to)
+		similar := cantusMotion*motion > 0
+		switch {
+		case similar && perfect(after) && abs(before)%12 == abs(after)%12:
+			cost += 20
+		case similar && perfect(after):
+			cost += 5
+		case similar:
+			cost++
+		}
+
+		// the voice reaches the final by step
+		if i == len(cantus)-1 && abs(int32(to-from)) != 1 {
+			cost += 3
+		}
+		return cost
+	}
+
+	costs := make([][]float64, len(cantus))
+	from := make([][]int, len(cantus))
+	for i := range cantus {
+		costs[i] = make([]float64, len(candidates[i]))
+		from[i] = make([]int, len(candidates[i]))
+		for k, step := range candidates[i] {
+			costs[i][k] = noteCost(i, step)
+			if i == 0 {
+				continue
+			}
+			best := -1.
+			for p, prev := range candidates[i-1] {
+				if cost := costs[i-1][p] + motionCost(i, prev, step); best < 0 || cost < best {
+					best, from[i][k] = cost, p
+				}
+			}
+			costs[i][k] += best
+		}
+	}
+
+	chosen := make([]int, len(cantus))
+	last := len(cantus) - 1
+	for k := range candidates[last] {
+		if costs[last][k] < costs[last][chosen[last]] {
+			chosen[last] = k
+		}
+	}
+	for i := last; i > 0; i-- {
+		chosen[i-1] = from[i][chosen[i]]
+	}
+
+	notes := make([]*Note, 0)
+	i := 0
+	for _, n := range c.Notes {
+		if n.Note == Rest {
+			notes = append(notes, n)
+			continue
+		}
+
+		step := candidates[i][chosen[i]]
+		voice := &Note{Velocity: n.Velocity, Duration: n.Duration}
+		voice.Note, voice.Tone = m.NoteAt(step)
+		notes = append(notes, voice)
+
+		// a third on a long note is filled by the step between
+		if i < last {
+			next := candidates[i+1][chosen[i+1]]
+			half, gap := fitDurations(n.Duration.Ticks(wr)/2, wr)
+			if abs(int32(next-step)) == 2 && n.Duration.Ticks(wr) >= 2*wr.MetricTicks.Ticks4th() && len(half) == 1 && gap == 0 {
+				voice.Duration = half[0]
+				passing := &Note{Velocity: n.Velocity, Duration: half[0]}
+				passing.Note, passing.Tone = m.NoteAt((step + next) / 2)
+				notes = append(notes, passing)
+			}
+		}
+		i++
+	}
+	c.Notes = notes
+	return c
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+func TestCounterpointRules(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+
+	m := &Melody{Scale: C, Mode: Ionian, Hash: "3efccdd9", TimeSignature: &TimeSignature{Numerator: 4, Denominator: 4}}
+	for _, step := range []int{35, 36, 37, 36, 38, 37, 36, 35} {
+		n := &Note{Velocity: 100, Duration: Crochtet}
+		n.Note, n.Tone = m.NoteAt(step)
+		m.Notes = append(m.Notes, n)
+	}
+
+	c := m.Counterpoint(wr, InstrumentRanges["Cello"])
+	if len(c.Notes) != len(m.Notes) {
+		t.Fatalf("Crochets expected to be answered note against note, got %d notes", len(c.Notes))
+	}
+
+	for i, n := range c.Notes {
+		interval := m.Notes[i].GetNoteTone() - n.GetNoteTone()
+		if interval <= 0 || !consonant(interval) {
+			t.Errorf("Note %d expected to be consonant below the cantus, got interval %d", i, interval)
+		}
+		if i == 0 && !perfect(interval) {
+			t.Errorf("Counterpoint expected to start on a perfect consonance, got %d", interval)
+		}
+		if i == len(c.Notes)-1 && interval%12 != 0 {
+			t.Errorf("Counterpoint expected to end on the octave, got %d", interval)
+		}
+
+		if i == 0 {
+			continue
+		}
+		before := m.Notes[i-1].GetNoteTone() - c.Notes[i-1].GetNoteTone()
+		similar := (m.Notes[i].GetNoteTone()-m.Notes[i-1].GetNoteTone())*(n.GetNoteTone()-c.Notes[i-1].GetNoteTone()) > 0
+		if similar && perfect(interval) && before%12 == interval%12 {
+			t.Errorf("Note %d expected not to move by parallel %d", i, interval)
+		}
+	}
+}
+
+func TestCounterpointPassingTone(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+
+	m := &Melody{Scale: C, Mode: Ionian, Hash: "1", TimeSignature: &TimeSignature{Numerator: 4, Denominator: 4}}
+	for _, step := range []int{35, 37, 36, 35} {
+		n := &Note{Velocity: 100, Duration: Minim}
+		n.Note, n.Tone = m.NoteAt(step)
+		m.Notes = append(m.Notes, n)
+	}
+
+	c := m.Counterpoint(wr, InstrumentRanges["Cello"])
+	passing := 0
+	for i := 1; i < len(c.Notes)-1; i++ {
+		n := c.Notes[i]
+		if n.Duration != Crochtet || c.Notes[i-1].Duration != Crochtet {
+			continue
+		}
+		passing++
+		prev, next := m.Step(c.Notes[i-1]), m.Step(c.Notes[i+1])
+		if step := m.Step(n); abs(int32(step-prev)) != 1 || abs(int32(next-step)) != 1 {
+			t.Errorf("Passing tone %d expected to move by step between %d and %d", step, prev, next)
+		}
+	}
+	if passing == 0 {
+		t.Errorf("Counterpoint expected to insert a passing tone, got %d notes", len(c.Notes))
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import "strings"
+
+// scale steps the harmony voice moves from the melody
+const (
+	SixthBelow = -5
+	ThirdBelow = -2
+	ThirdAbove = 2
+	SixthAbove = 5
+)
+
+// DoublingFor lets the hash choose the interval the melody is doubled at
+func DoublingFor(hash string) int {
+	hash = strings.TrimLeft(hash, "0")
+	if len(hash) < 4 {
+		return ThirdBelow
+	}
+	return []int{ThirdBelow, ThirdAbove, SixthBelow, SixthAbove}[hash[3]%4]
+}
+
+// Double returns the melody moved by the scale steps of its doubling, every
+// note staying in the key and moved by octaves into the range. Without a
+// doubling the voice is silent.
+func (m *Melody) Double(r Range) *Melody {
+	c := m.Clone()
+	if m.Doubling == 0 {
+		c.Silent = true
+		return c
+	}
+
+	for _, n := range c.Notes {
+		if n.Note == Rest {
+			continue
+		}
+		n.Note, n.Tone = m.NoteAt(m.Step(n) + m.Doubling)
+		for n.GetNoteTone() < r.Low {
+			n.Tone++
+		}
+		for n.GetNoteTone() > r.High {
+			n.Tone--
+		}
+		if m.Dynamics {
+			n.Velocity = clampVelocity(n.Velocity + harmonyVelocity/2)
+		}
+	}
+	return c
+}
@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestDoubleInKey(t *testing.T) {
+	m := &Melody{Scale: C, Mode: Ionian, Doubling: ThirdBelow, TimeSignature: &TimeSignature{Numerator: 4, Denominator: 4}}
+	for _, note := range []int32{m.Tonic(), m.Second(), m.Third(), m.Quarte(), m.Quinte(), m.Sixte(), m.Seventh()} {
+		m.Notes = append(m.Notes, &Note{Note: note, Tone: 5, Duration: Crochtet, Velocity: 80})
+	}
+	m.Notes = append(m.Notes, &Note{Note: Rest, Duration: Crochtet})
+
+	d := m.Double(Range{48, 84})
+	want := []int32{57, 59, 60, 62, 64, 65, 67}
+	for i, n := range d.Notes[:7] {
+		if n.GetNoteTone() != want[i] {
+			t.Errorf("Note %d expected a third below at %d, got %d", i, want[i], n.GetNoteTone())
+		}
+	}
+	if d.Notes[7].Note != Rest {
+		t.Errorf("Rest expected to stay a rest")
+	}
+	if m.Notes[0].GetNoteTone() != 60 {
+		t.Errorf("Melody expected to be left as it is, got %d", m.Notes[0].GetNoteTone())
+	}
+
+	m.Doubling = SixthAbove
+	if d := m.Double(Range{48, 72}); d.Notes[6].GetNoteTone() != 67 {
+		t.Errorf("Sixth above the B expected folded into range on G5, got %d", d.Notes[6].GetNoteTone())
+	}
+
+	m.Doubling = 0
+	if d := m.Double(Range{48, 84}); !d.Silent {
+		t.Errorf("Melody without doubling expected a silent voice")
+	}
+}
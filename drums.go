@@ -0,0 +1,156 @@
+package main
+
+import (
+	"strings"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+// General MIDI percussion channel, the tenth
+const drumChannel uint8 = 9
+
+// General MIDI percussion keys
+const (
+	Kick      uint8 = 36
+	Snare     uint8 = 38
+	ClosedHat uint8 = 42
+	LowTom    uint8 = 45
+	OpenHat   uint8 = 46
+	MidTom    uint8 = 47
+	Crash     uint8 = 49
+	HighTom   uint8 = 50
+)
+
+// DrumMeasure returns the drums hit on every semiquaver of the measure: the
+// kick starts the groups of beats, the snare ends them and the hats keep the
+// quavers. The hash character of the measure varies the pattern and the last
+// measure of a phrase ends on a fill.
+func (m *Melody) DrumMeasure(wr *writer.SMF, measure uint8, fill bool) [][]uint8 {
+	semiquaver := wr.MetricTicks.Ticks4th() / 4
+	beat := wr.MetricTicks.Ticks4th() * 4 / uint32(m.TimeSignature.Denominator) / semiquaver
+	steps := m.TimeSignature.MeasureTicks(wr) / semiquaver
+	hits := make([][]uint8, steps)
+
+	variation := byte(0)
+	if hash := strings.TrimLeft(m.Hash, "0"); len(hash) > 0 {
+		variation = hash[int(measure)%len(hash)]
+	}
+
+	hat := beat / 2
+	if hat == 0 || variation%5 == 4 {
+		hat = beat
+	}
+	for s := uint32(0); s < steps; s += hat {
+		hits[s] = append(hits[s], ClosedHat)
+	}
+
+	start := uint32(0)
+	groups := m.TimeSignature.Groups()
+	for i, g := range groups {
+		hits[start*beat] = append(hits[start*beat], Kick)
+		if g > 1 {
+			back := (start + uint32(g) - 1) * beat
+			hits[back] = append(hits[back], Snare)
+		}
+		// a kick pushed on the quaver before the next group
+		if variation%2 == 1 && i+1 < len(groups) && beat > 1 {
+			push := (start+uint32(g))*beat - beat/2
+			hits[push] = append(hits[push], Kick)
+		}
+		start += uint32(g)
+	}
+	if variation%3 == 2 && steps >= hat {
+		last := steps - hat
+		hits[last] = append(hits[last], OpenHat)
+	}
+
+	if fill {
+		m.fill(hits, beat*uint32(groups[len(groups)-1]))
+	}
+	return hits
+}
+
+// fill replaces the last steps of the measure with semiquavers rolling from the
+// snare down the toms
+func (m *Melody) fill(hits [][]uint8, steps uint32) {
+	if steps > uint32(len(hits)) {
+		steps = uint32(len(hits))
+	}
+	toms := []uint8{Snare, Snare, HighTom, HighTom, MidTom, MidTom, LowTom, LowTom}
+	from := uint32(len(hits)) - steps
+	for s := from; s < uint32(len(hits)); s++ {
+		tom := toms[(s-from)*uint32(len(toms))/steps]
+		hits[s] = []uint8{tom}
+	}
+	hits[from] = append(hits[from], Kick)
+}
+
+// playDrums hits the drums of every step, each ringing until the next hit
+func (m *Melody) playDrums(wr *writer.SMF, hits [][]uint8, crash bool) {
+	semiquaver := wr.MetricTicks.Ticks4th() / 4
+	measureTicks := m.TimeSignature.MeasureTicks(wr)
+
+	var ringing []uint8
+	pending := uint32(0)
+	for s, drums := range hits {
+		length := m.groove(semiquaver)
+		if len(drums) == 0 {
+			pending += length
+			continue
+		}
+		if s == 0 && crash {
+			drums = append([]uint8{Crash}, drums...)
+		}
+
+		m.forward(wr, pending)
+		for _, d := range ringing {
+			writer.NoteOff(wr, d)
+		}
+		for _, d := range drums {
+			velocity := int32(100)
+			if m.Dynamics {
+				velocity = clampVelocity(phraseVelocity + m.TimeSignature.Accent(wr, uint32(s)*semiquaver%measureTicks))
+			}
+			if m.Humanize != nil {
+				velocity = m.Humanize.velocity(velocity)
+			}
+			writer.NoteOn(wr, d, uint8(velocity))
+		}
+		ringing, pending = drums, length
+	}
+
+	m.forward(wr, pending)
+	for _, d := range ringing {
+		writer.NoteOff(wr, d)
+	}
+}
+
+// BuildDrums plays a pattern a measure of the melody, with a fill closing
+// every phrase and a crash opening the next
+func (m *Melody) BuildDrums(wr *writer.SMF) {
+	m.grooved = 0
+	crash := true
+	for i := uint8(1); i <= m.Measures; i++ {
+		if _, ok := m.Phrases[i]; !ok {
+			continue
+		}
+		fill := i%phraseMeasures == 0 || i == m.Measures
+		m.playDrums(wr, m.DrumMeasure(wr, i, fill), crash)
+		crash = fill
+	}
+}
+
+// BuildDrums keeps the pattern of the next melody over the transition,
+// filling into it
+func (t *Transition) BuildDrums(wr *writer.SMF) {
+	for i := range t.Chords {
+		t.To.playDrums(wr, t.To.DrumMeasure(wr, uint8(i), i == len(t.Chords)-1), false)
+	}
+}
+
+// BuildDrums follows the sections of the melody track, ending on a crash
+func (s *Song) BuildDrums(wr *writer.SMF) {
+	s.build(wr, (*Melody).BuildDrums, (*Transition).BuildDrums, func(last *Melody, wr *writer.SMF) {
+		last.playDrums(wr, [][]uint8{{Kick}}, true)
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+func hitsOf(hits []uint8, drum uint8) bool {
+	for _, h := range hits {
+		if h == drum {
+			return true
+		}
+	}
+	return false
+}
+
+func TestDrumMeasure(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+
+	for _, test := range []struct {
+		ts     TimeSignature
+		kicks  []int
+		snares []int
+	}{
+		{TimeSignature{2, 4}, []int{0}, []int{4}},
+		{TimeSignature{3, 4}, []int{0}, []int{8}},
+		{TimeSignature{4, 4}, []int{0, 8}, []int{4, 12}},
+		{TimeSignature{5, 4}, []int{0, 12}, []int{8, 16}},
+		{TimeSignature{7, 4}, []int{0, 12, 20}, []int{8, 16, 24}},
+	} {
+		m := &Melody{Hash: "8", TimeSignature: &TimeSignature{test.ts.Numerator, test.ts.Denominator}}
+		hits := m.DrumMeasure(wr, 0, false)
+		if len(hits) != int(test.ts.Numerator)*4 {
+			t.Fatalf("%d/%d expected %d steps, got %d", test.ts.Numerator, test.ts.Denominator, test.ts.Numerator*4, len(hits))
+		}
+		for _, s := range test.kicks {
+			if !hitsOf(hits[s], Kick) {
+				t.Errorf("%d/%d expected a kick on step %d", test.ts.Numerator, test.ts.Denominator, s)
+			}
+		}
+		for _, s := range test.snares {
+			if !hitsOf(hits[s], Snare) {
+				t.Errorf("%d/%d expected a snare on step %d", test.ts.Numerator, test.ts.Denominator, s)
+			}
+		}
+	}
+}
+
+func TestDrumFill(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+	m := &Melody{Hash: "8", TimeSignature: &TimeSignature{Numerator: 4, Denominator: 4}}
+
+	hits := m.DrumMeasure(wr, 0, true)
+	for s := 8; s < 16; s++ {
+		if hitsOf(hits[s], ClosedHat) || len(hits[s]) == 0 {
+			t.Errorf("Fill expected to roll on step %d, got %v", s, hits[s])
+		}
+	}
+	if !hitsOf(hits[15], LowTom) {
+		t.Errorf("Fill expected to end on the low tom, got %v", hits[15])
+	}
+}
+
+func TestDrumVariation(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+	plain := &Melody{Hash: "8", TimeSignature: &TimeSignature{Numerator: 4, Denominator: 4}}
+	pushed := &Melody{Hash: "1", TimeSignature: &TimeSignature{Numerator: 4, Denominator: 4}}
+
+	if hitsOf(plain.DrumMeasure(wr, 0, false)[6], Kick) {
+		t.Errorf("Hash 8 expected no pushed kick")
+	}
+	if !hitsOf(pushed.DrumMeasure(wr, 0, false)[6], Kick) {
+		t.Errorf("Hash 1 expected to push a kick before the second group")
+	}
+}
+
+func TestSilentDrumMeasureKeepsTime(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+	m := &Melody{Hash: "8", TimeSignature: &TimeSignature{Numerator: 4, Denominator: 4}}
+	measureTicks := uint64(m.TimeSignature.MeasureTicks(wr))
+
+	// a measure without hits leaves its time to the next one
+	m.playDrums(wr, make([][]uint8, 16), false)
+	m.playDrums(wr, m.DrumMeasure(wr, 0, false), false)
+	if wr.Position() != 2*measureTicks {
+		t.Errorf("Drums expected to end after two measures at %d, got %d", 2*measureTicks, wr.Position())
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"strings"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+// velocities a phrase starts, climbs and settles to
+const (
+	phraseVelocity  int32 = 72
+	climaxVelocity  int32 = 96
+	cadenceVelocity int32 = 64
+)
+
+// velocity added to the notes by their place in the measure
+const (
+	downbeatAccent int32 = 12
+	groupAccent    int32 = 6
+	offbeatAccent  int32 = -6
+	hashAccent     int32 = 10
+)
+
+// accompaniment stays under the melody
+const harmonyVelocity int32 = -12
+
+// Groups splits the beats of the measure in groups of two or three, each
+// starting on a strong beat
+func (ts *TimeSignature) Groups() []uint8 {
+	n := ts.Numerator
+	if n <= 3 {
+		return []uint8{n}
+	}
+
+	groups := make([]uint8, 0)
+	size := uint8(2)
+	if n%3 == 0 {
+		size = 3
+	} else if n%2 != 0 {
+		groups = append(groups, 3)
+		n -= 3
+	}
+	for ; n > 0; n -= size {
+		groups = append(groups, size)
+	}
+	return groups
+}
+
+// Accent tells how much the position of the measure is stressed: the downbeat
+// most, the beats starting a group less, the offbeats not at all
+func (ts *TimeSignature) Accent(wr *writer.SMF, position uint32) int32 {
+	beat := wr.MetricTicks.Ticks4th() * 4 / uint32(ts.Denominator)
+	if position%beat != 0 {
+		return offbeatAccent
+	}
+	if position == 0 {
+		return downbeatAccent
+	}
+
+	start := uint32(0)
+	for _, g := range ts.Groups() {
+		if position/beat == start {
+			return groupAccent
+		}
+		start += uint32(g)
+	}
+	return 0
+}
+
+// ShapeDynamics sets the velocity of every note from the meter, a crescendo
+// toward the highest note of the phrase then a diminuendo to its cadence, and
+// accents where the hash has an f
+func (m *Melody) ShapeDynamics(wr *writer.SMF) {
+	if !m.Dynamics {
+		return
+	}
+	hash := strings.TrimLeft(m.Hash, "0")
+
+	measureTicks := m.TimeSignature.MeasureTicks(wr)
+	phrases := make([][]*Note, 0)
+	accents := make(map[*Note]int32)
+	position := uint32(0)
+	for i, n := range m.Notes {
+		phrase := int(position / measureTicks / phraseMeasures)
+		for len(phrases) <= phrase {
+			phrases = append(phrases, nil)
+		}
+		phrases[phrase] = append(phrases[phrase], n)
+
+		accents[n] = m.TimeSignature.Accent(wr, position%measureTicks)
+		if len(hash) > 0 && hash[i%len(hash)] == 'f' {
+			accents[n] += hashAccent
+		}
+		position += n.Duration.Ticks(wr)
+	}
+
+	for _, notes := range phrases {
+		climax := 0
+		for i, n := range notes {
+			if n.Note != Rest && n.GetNoteTone() > notes[climax].GetNoteTone() {
+				climax = i
+			}
+		}
+
+		for i, n := range notes {
+			velocity := climaxVelocity
+			if i < climax {
+				velocity = phraseVelocity + (climaxVelocity-phraseVelocity)*int32(i)/int32(climax)
+			} else if i > climax {
+				velocity = climaxVelocity - (climaxVelocity-cadenceVelocity)*int32(i-climax)/int32(len(notes)-1-climax)
+			}
+			n.Velocity = clampVelocity(velocity + accents[n])
+		}
+	}
+}
+
+// HoldVelocity is the velocity of the notes held over transitions and endings
+func (m *Melody) HoldVelocity() int32 {
+	if m.Dynamics {
+		return cadenceVelocity
+	}
+	return 100
+}
+
+// Balance lets the top note of the chord sing over the bass and the inner
+// voices
+func (c *Chord) Balance(velocity int32) {
+	for i, n := range c.Notes {
+		switch i {
+		case len(c.Notes) - 1:
+			n.Velocity = clampVelocity(velocity)
+		case 0:
+			n.Velocity = clampVelocity(velocity - 6)
+		default:
+			n.Velocity = clampVelocity(velocity - 12)
+		}
+	}
+}
+
+func clampVelocity(v int32) int32 {
+	if v < 1 {
+		return 1
+	}
+	if v > 127 {
+		return 127
+	}
+	return v
+}
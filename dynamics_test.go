@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+func TestTimeSignatureGroups(t *testing.T) {
+	for numerator, want := range map[uint8][]uint8{
+		2: {2},
+		3: {3},
+		4: {2, 2},
+		5: {3, 2},
+		6: {3, 3},
+		7: {3, 2, 2},
+	} {
+		ts := &TimeSignature{Numerator: numerator, Denominator: 4}
+		if groups := ts.Groups(); !reflect.DeepEqual(groups, want) {
+			t.Errorf("%d/4 expected to group beats by %v, got %v", numerator, want, groups)
+		}
+	}
+}
+
+func TestTimeSignatureAccent(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+	beat := wr.MetricTicks.Ticks4th()
+
+	ts := &TimeSignature{Numerator: 4, Denominator: 4}
+	for position, want := range map[uint32]int32{
+		0:          downbeatAccent,
+		beat:       0,
+		2 * beat:   groupAccent,
+		beat + 480: offbeatAccent,
+	} {
+		if accent := ts.Accent(wr, position); accent != want {
+			t.Errorf("4/4 position %d expected accent %d, got %d", position, want, accent)
+		}
+	}
+}
+
+func TestShapeDynamics(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+
+	m := &Melody{Scale: C, Mode: Ionian, Hash: "1", Dynamics: true, TimeSignature: &TimeSignature{Numerator: 4, Denominator: 4}}
+	for _, step := range []int{35, 36, 37, 38, 39, 38, 37, 36} {
+		n := &Note{Duration: Minim}
+		n.Note, n.Tone = m.NoteAt(step)
+		m.Notes = append(m.Notes, n)
+	}
+	m.ShapeDynamics(wr)
+
+	if v := m.Notes[4].Velocity; v != climaxVelocity+downbeatAccent {
+		t.Errorf("Climax expected to reach velocity %d, got %d", climaxVelocity+downbeatAccent, v)
+	}
+	// every downbeat before the climax grows louder
+	for i := 0; i < 4; i += 2 {
+		if m.Notes[i].Velocity >= m.Notes[i+2].Velocity {
+			t.Errorf("Note %d expected to crescendo toward the climax, got %d then %d", i, m.Notes[i].Velocity, m.Notes[i+2].Velocity)
+		}
+	}
+	if m.Notes[4].Velocity <= m.Notes[6].Velocity {
+		t.Errorf("Note 6 expected to diminish after the climax, got %d then %d", m.Notes[4].Velocity, m.Notes[6].Velocity)
+	}
+	if v := m.Notes[7].Velocity; v != cadenceVelocity+groupAccent {
+		t.Errorf("Last note expected to settle to velocity %d, got %d", cadenceVelocity+groupAccent, v)
+	}
+}
+
+func TestChordBalance(t *testing.T) {
+	m := &Melody{Scale: C, Mode: Ionian}
+	c := m.Chord(I, &ChordAlteration{Seven: true}, Crochtet)
+	c.Balance(80)
+
+	top := c.Notes[len(c.Notes)-1].Velocity
+	for _, n := range c.Notes[:len(c.Notes)-1] {
+		if n.Velocity >= top {
+			t.Errorf("Top note expected to sing over %d, got %d under %d", n.GetNoteTone(), n.Velocity, top)
+		}
+	}
+}
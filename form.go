@@ -0,0 +1,301 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+type SectionKind uint8
+
+const (
+	Intro SectionKind = iota
+	Verse
+	Chorus
+	Bridge
+	Outro
+)
+
+func (k SectionKind) String() string {
+	switch k {
+	case Intro:
+		return "Intro"
+	case Verse:
+		return "Verse"
+	case Chorus:
+		return "Chorus"
+	case Bridge:
+		return "Bridge"
+	}
+	return "Outro"
+}
+
+// forms by initial of their sections
+const (
+	AABA        = "IVVBVO"
+	VerseChorus = "IVCVCBCCO"
+)
+
+// themes a song needs: verse, chorus and bridge
+const songThemes = 3
+
+type Section struct {
+	Kind   SectionKind
+	Name   string // marker written at the start of the section
+	Melody *Melody
+	Start  uint64 // ticks from the start of the melody track, the other tracks follow it
+	End    uint64
+}
+
+type Song struct {
+	Form        string
+	Sections    []*Section
+	End         uint64
+	Instruments map[string]string // General MIDI instrument of each part, picked from the hash when missing
+}
+
+// Themes makes one melody per block, or cuts a single hash into segments
+// keeping its leading zeros when there are not enough blocks for a song
+func Themes(hashes []string) []*Melody {
+	if len(hashes) >= songThemes || len(hashes) == 0 {
+		themes := make([]*Melody, 0)
+		for _, h := range hashes {
+			themes = append(themes, NewMelody(h))
+		}
+		return themes
+	}
+
+	themes := make([]*Melody, 0)
+	for _, h := range hashes {
+		trimmed := strings.TrimLeft(h, "0")
+		zeros := h[:len(h)-len(trimmed)]
+		size := len(trimmed) / songThemes
+		for i := 0; i < songThemes; i++ {
+			segment := trimmed[i*size:]
+			if i < songThemes-1 {
+				segment = segment[:size]
+			}
+			themes = append(themes, NewMelody(zeros+segment))
+		}
+	}
+	return themes
+}
+
+// NewSong lays the themes out in sections: the first is the verse, the second
+// the chorus, the third the bridge and the next ones feed later verses. The
+// hash of the verse picks an AABA or a verse-chorus form. Intro and outro
+// play the harmony of the first phrase of the verse and of the last one of the
+// chorus.
+func NewSong(wr *writer.SMF, themes []*Melody) *Song {
+	if len(themes) == 0 {
+		return &Song{}
+	}
+	theme := func(i int) *Melody {
+		if i < len(themes) {
+			return themes[i]
+		}
+		return themes[0]
+	}
+	verse, chorus, bridge := theme(0), theme(1), theme(2)
+
+	s := &Song{Form: VerseChorus}
+	if hash := strings.TrimLeft(verse.Hash, "0"); len(hash) > 0 && hash[len(hash)-1]%2 == 0 {
+		s.Form = AABA
+	}
+
+	count := make(map[SectionKind]int)
+	add := func(kind SectionKind, m *Melody) {
+		count[kind]++
+		name := kind.String()
+		if kind == Verse || kind == Chorus {
+			name = fmt.Sprintf("%s %d", name, count[kind])
+		}
+		s.Sections = append(s.Sections, &Section{Kind: kind, Name: name, Melody: m})
+	}
+
+	for _, c := range s.Form {
+		switch c {
+		case 'I':
+			intro := verse.Excerpt(wr, 1, phraseMeasures)
+			intro.Silent = true
+			add(Intro, intro)
+		case 'V':
+			m := verse
+			if count[Verse] > 0 && len(themes) > songThemes+count[Verse]-1 {
+				m = themes[songThemes+count[Verse]-1]
+			}
+			add(Verse, m.Clone())
+		case 'C':
+			add(Chorus, chorus.Clone())
+		case 'B':
+			add(Bridge, bridge.Clone())
+		case 'O':
+			last := chorus
+			if s.Form == AABA {
+				last = verse
+			}
+			from := uint8(1)
+			if measures := last.CountMeasures(wr); measures > phraseMeasures {
+				from = measures - phraseMeasures + 1
+			}
+			outro := last.Excerpt(wr, from, phraseMeasures)
+			outro.Silent = true
+			add(Outro, outro)
+		}
+	}
+	s.Layout(wr)
+	return s
+}
+
+// Layout places the sections from the start of the song, after the
+// transition into each, and ends the song a measure after the last one
+func (s *Song) Layout(wr *writer.SMF) {
+	position := uint64(0)
+	for i, section := range s.Sections {
+		m := section.Melody
+		measureTicks := uint64(m.TimeSignature.MeasureTicks(wr))
+		if i > 0 {
+			position += uint64(len(NewTransition(s.Sections[i-1].Melody, m).Chords)) * measureTicks
+		}
+		section.Start = position
+		position += uint64(m.CountMeasures(wr)) * measureTicks
+		section.End = position
+	}
+	if len(s.Sections) > 0 {
+		last := s.Sections[len(s.Sections)-1].Melody
+		position += uint64(last.TimeSignature.MeasureTicks(wr))
+	}
+	s.End = position
+}
+
+// Clone copies the melody and its notes before they are played, so a section
+// can be played again
+func (m *Melody) Clone() *Melody {
+	c := *m
+	c.Phrases = nil
+	c.Progression = nil
+	c.Notes = make([]*Note, 0, len(m.Notes))
+	for _, n := range m.Notes {
+		note := *n
+		note.Tie, note.Tied = nil, false
+		c.Notes = append(c.Notes, &note)
+	}
+	return &c
+}
+
+// CountMeasures counts the measures the notes start in
+func (m *Melody) CountMeasures(wr *writer.SMF) uint8 {
+	ticks := uint32(0)
+	for _, n := range m.Notes {
+		ticks += n.Duration.Ticks(wr)
+	}
+	measureTicks := m.TimeSignature.MeasureTicks(wr)
+	return uint8((ticks + measureTicks - 1) / measureTicks)
+}
+
+// Excerpt clones the notes starting in count measures from the one given
+func (m *Melody) Excerpt(wr *writer.SMF, from, count uint8) *Melody {
+	c := m.Clone()
+	notes := c.Notes
+	c.Notes = make([]*Note, 0)
+
+	measureTicks := m.TimeSignature.MeasureTicks(wr)
+	position := uint32(0)
+	for _, n := range notes {
+		measure := uint8(position/measureTicks) + 1
+		position += n.Duration.Ticks(wr)
+		if measure >= from && measure < from+count {
+			c.Notes = append(c.Notes, n)
+		}
+	}
+	return c
+}
+
+// BuildConductor writes the meter of every section from the transition into
+// it and marks where the section starts by its name
+func (s *Song) BuildConductor(wr *writer.SMF) {
+	origin := wr.Position()
+	at := func(position uint64) {
+		if p := origin + position; p > wr.Position() {
+			writer.Forward(wr, 0, uint32(p-wr.Position()), wr.MetricTicks.Ticks4th()*4)
+		}
+	}
+	for i, section := range s.Sections {
+		if i > 0 {
+			at(s.Sections[i-1].End)
+		}
+		m := section.Melody
+		writer.Meter(wr, m.TimeSignature.Numerator, m.TimeSignature.Denominator)
+		at(section.Start)
+		writer.Marker(wr, section.Name)
+	}
+	at(s.End)
+}
+
+// build writes a track along the sections: every section from its barline,
+// the transition into it from the end of the one before, and the ending from
+// the end of the last one, so all the tracks keep the same ticks
+func (s *Song) build(wr *writer.SMF, section func(*Melody, *writer.SMF), transition func(*Transition, *writer.SMF), ending func(*Melody, *writer.SMF)) {
+	origin := wr.Position()
+	for i, sec := range s.Sections {
+		if i > 0 {
+			pad(wr, origin+s.Sections[i-1].End)
+			transition(NewTransition(s.Sections[i-1].Melody, sec.Melody), wr)
+		}
+		pad(wr, origin+sec.Start)
+		section(sec.Melody, wr)
+	}
+	if len(s.Sections) == 0 {
+		return
+	}
+
+	pad(wr, origin+s.Sections[len(s.Sections)-1].End)
+	ending(s.Sections[len(s.Sections)-1].Melody, wr)
+	pad(wr, origin+s.End)
+}
+
+// BuildMelody writes the sections one after the other from their barline,
+// modulating between them, and holds the tonic of the last one to end
+func (s *Song) BuildMelody(wr *writer.SMF) {
+	s.build(wr, (*Melody).BuildMelody, (*Transition).BuildMelody, func(last *Melody, wr *writer.SMF) {
+		last.Hold(wr, last.Tonic(), last.FinalTone(), last.HoldVelocity()).Play(wr)
+	})
+}
+
+// BuildHarmony follows the sections of the melody track, ending on the tonic
+// chord of the last one
+func (s *Song) BuildHarmony(wr *writer.SMF) {
+	s.build(wr, (*Melody).BuildHarmony, (*Transition).BuildHarmony, func(last *Melody, wr *writer.SMF) {
+		(&Transition{From: last, To: last, Chords: []TransitionChord{{Key: last, Degree: I}}}).BuildHarmony(wr)
+	})
+}
+
+// Voice derives another line from the melody of every section, before the
+// melody is played
+func (s *Song) Voice(voice func(m *Melody) *Melody) []*Melody {
+	voices := make([]*Melody, 0)
+	for _, section := range s.Sections {
+		voices = append(voices, voice(section.Melody))
+	}
+	return voices
+}
+
+// BuildVoice plays the lines derived from the sections along the melody track,
+// resting during the transitions, and holds the tonic in the octave given to
+// end
+func (s *Song) BuildVoice(wr *writer.SMF, voices []*Melody, tone int32) {
+	origin := wr.Position()
+	for i, section := range s.Sections {
+		pad(wr, origin+section.Start)
+		voices[i].BuildMelody(wr)
+	}
+	if len(s.Sections) == 0 {
+		return
+	}
+
+	last := voices[len(voices)-1]
+	pad(wr, origin+s.Sections[len(s.Sections)-1].End)
+	last.Hold(wr, last.Tonic(), tone, last.HoldVelocity()).Play(wr)
+	pad(wr, origin+s.End)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+func TestThemesFromSingleHash(t *testing.T) {
+	hash := "00000000000000000003efccdd987dd6d93ba18327eef8fd4b46d0de863eb14c"
+	themes := Themes([]string{hash})
+	if len(themes) != songThemes {
+		t.Fatalf("Single hash expected to give %d themes, got %d", songThemes, len(themes))
+	}
+
+	joined := ""
+	for _, m := range themes {
+		if !strings.HasPrefix(m.Hash, "0000000000000000000") {
+			t.Errorf("Theme %s expected to keep the leading zeros of the hash", m.Hash)
+		}
+		joined += strings.TrimLeft(m.Hash, "0")
+	}
+	if joined != strings.TrimLeft(hash, "0") {
+		t.Errorf("Themes expected to cover the hash, got %s", joined)
+	}
+}
+
+func TestSongForms(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+
+	themes := Themes([]string{
+		"00000000000000000003efccdd987dd6d93ba18327eef8fd4b46d0de863eb14c",
+		"000000000000000000051f8864b8eddf483e7d2b941d626ecea1de70fa0bf551",
+		"0000000000000000000e760a04fc958a0631d47490b5f111d0d6aca418b9df17",
+		"00000000000000000011f9866ca32fbbbb3cfba26af498dcd98c0f013a920021",
+	})
+	song := NewSong(wr, themes)
+	if song.Form != VerseChorus {
+		t.Fatalf("Verse hash ending in c expected to give a verse-chorus form, got %s", song.Form)
+	}
+
+	names := make([]string, 0)
+	for _, s := range song.Sections {
+		names = append(names, s.Name)
+	}
+	if want := "Intro Verse 1 Chorus 1 Verse 2 Chorus 2 Bridge Chorus 3 Chorus 4 Outro"; strings.Join(names, " ") != want {
+		t.Errorf("Sections expected to be %s, got %s", want, strings.Join(names, " "))
+	}
+
+	if song.Sections[2].Melody == song.Sections[4].Melody || song.Sections[2].Melody.Notes[0] == song.Sections[4].Melody.Notes[0] {
+		t.Errorf("Repeated choruses expected to be played from their own notes")
+	}
+	if song.Sections[3].Melody.Hash != themes[3].Hash {
+		t.Errorf("Second verse expected to come from the fourth block")
+	}
+	if !song.Sections[0].Melody.Silent || song.Sections[1].Melody.Silent {
+		t.Errorf("Only intro and outro expected to leave the melody to the harmony")
+	}
+
+	themes[0] = NewMelody("00000000000000000003efccdd987dd6d93ba18327eef8fd4b46d0de863eb142")
+	if song := NewSong(wr, themes); song.Form != AABA {
+		t.Errorf("Verse hash ending in 2 expected to give an AABA form, got %s", song.Form)
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+
+	m := &Melody{TimeSignature: &TimeSignature{Numerator: 4, Denominator: 4}}
+	for i := int32(0); i < 8; i++ {
+		m.Notes = append(m.Notes, &Note{Note: i, Tone: 5, Duration: Minim})
+	}
+	if measures := m.CountMeasures(wr); measures != 4 {
+		t.Fatalf("Eight minims in 4/4 expected to last 4 measures, got %d", measures)
+	}
+
+	e := m.Excerpt(wr, 2, 2)
+	if len(e.Notes) != 4 || e.Notes[0].Note != 2 || e.Notes[3].Note != 5 {
+		t.Errorf("Measures 2 and 3 expected to hold the notes 2 to 5, got %d notes", len(e.Notes))
+	}
+	if e.Notes[0] == m.Notes[2] {
+		t.Errorf("Excerpt expected to copy the notes")
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+// Groove moves the positions of a cycle by the ticks of its offsets, the ones
+// between following the line from an offset to the next. The cycle starts and
+// ends on its beat, so notes stay in their measure.
+type Groove struct {
+	Name    string
+	Cycle   uint32           // ticks, a beat or a measure
+	Offsets map[uint32]int32 // ticks a position of the cycle is played late, or early when negative
+}
+
+func NewGroove(name string, cycle uint32, offsets map[uint32]int32) *Groove {
+	return &Groove{Name: name, Cycle: cycle, Offsets: offsets}
+}
+
+// Swing delays the offbeat quaver so the beat is split by the ratio given,
+// two thirds for a triplet feel
+func Swing(wr *writer.SMF, ratio float64) *Groove {
+	beat := wr.MetricTicks.Ticks4th()
+	return NewGroove("swing", beat, map[uint32]int32{
+		beat / 2: int32(ratio*float64(beat)) - int32(beat/2),
+	})
+}
+
+// Shuffle swings the semiquavers by a triplet
+func Shuffle(wr *writer.SMF) *Groove {
+	quaver := wr.MetricTicks.Ticks4th() / 2
+	return NewGroove("shuffle", quaver, map[uint32]int32{
+		quaver / 2: int32(quaver / 6),
+	})
+}
+
+// Clave leans the measure into the 3-3-2 tresillo: its second and third hits
+// are pushed and the quavers before them laid back
+func Clave(wr *writer.SMF, ts *TimeSignature) *Groove {
+	measure := ts.MeasureTicks(wr)
+	push := int32(wr.MetricTicks.Ticks4th() / 24)
+	return NewGroove("clave", measure, map[uint32]int32{
+		measure * 2 / 8: push,
+		measure * 3 / 8: -push,
+		measure * 5 / 8: push,
+		measure * 6 / 8: -push,
+	})
+}
+
+// GrooveFor lets the last character of the hash choose the feel, straight
+// for most of them
+func GrooveFor(wr *writer.SMF, hash string, ts *TimeSignature) *Groove {
+	hash = strings.TrimLeft(hash, "0")
+	if len(hash) == 0 {
+		return nil
+	}
+	switch hash[len(hash)-1] {
+	case 'a', '2':
+		return Swing(wr, 2./3)
+	case 'b', '5':
+		return Swing(wr, 0.6)
+	case 'c':
+		return Shuffle(wr)
+	case 'd', '7':
+		return Clave(wr, ts)
+	}
+	return nil
+}
+
+// Offset interpolates the ticks the position is moved by
+func (g *Groove) Offset(position uint32) int32 {
+	position %= g.Cycle
+
+	positions := []uint32{0, g.Cycle}
+	for p := range g.Offsets {
+		positions = append(positions, p)
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+
+	offset := func(p uint32) int32 {
+		if p == 0 || p == g.Cycle {
+			return 0
+		}
+		return g.Offsets[p]
+	}
+	for i := 1; i < len(positions); i++ {
+		from, to := positions[i-1], positions[i]
+		if position < from || position >= to {
+			continue
+		}
+		return offset(from) + (offset(to)-offset(from))*int32(position-from)/int32(to-from)
+	}
+	return 0
+}
+
+// groove returns how long the event at the current position of the track
+// lasts once its start and end are moved by the groove, and moves on
+func (m *Melody) groove(ticks uint32) uint32 {
+	start := m.grooved
+	m.grooved += ticks
+	if m.Groove == nil {
+		return ticks
+	}
+	return uint32(int32(ticks) + m.Groove.Offset(m.grooved) - m.Groove.Offset(start))
+}
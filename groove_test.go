@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+func TestSwingOffset(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+	beat := wr.MetricTicks.Ticks4th()
+	g := Swing(wr, 2./3)
+
+	for position, want := range map[uint32]int32{
+		0:                 0,
+		beat / 2:          int32(beat / 6),
+		beat/2 + beat:     int32(beat / 6),
+		beat / 4:          int32(beat / 12),
+		beat:              0,
+		3*beat/4 + 4*beat: int32(beat / 12),
+	} {
+		if offset := g.Offset(position); offset != want {
+			t.Errorf("Swing expected to move position %d by %d, got %d", position, want, offset)
+		}
+	}
+}
+
+func TestGrooveKeepsMeasure(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+	ts := &TimeSignature{Numerator: 4, Denominator: 4}
+	quaver := NoteDuration(Quaver).Ticks(wr)
+
+	for _, g := range []*Groove{Swing(wr, 0.6), Shuffle(wr), Clave(wr, ts)} {
+		m := &Melody{Groove: g}
+		total := uint32(0)
+		for i := 0; i < 8; i++ {
+			length := m.groove(quaver)
+			if length == 0 || length > 2*quaver {
+				t.Errorf("%s quaver %d expected to keep a sensible length, got %d", g.Name, i, length)
+			}
+			total += length
+		}
+		if total != ts.MeasureTicks(wr) {
+			t.Errorf("%s expected to keep the measure length, got %d", g.Name, total)
+		}
+	}
+}
+
+func TestGrooveMelodyGrid(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+	m := &Melody{TimeSignature: &TimeSignature{Numerator: 2, Denominator: 4}, Groove: Swing(wr, 2./3)}
+	for i := 0; i < 4; i++ {
+		m.Notes = append(m.Notes, &Note{Note: C, Tone: 5, Velocity: 100, Duration: Quaver})
+	}
+
+	m.play(wr, m.Notes[0])
+	if want := uint64(2 * wr.MetricTicks.Ticks4th() / 3); wr.Position() != want {
+		t.Errorf("Swung downbeat quaver expected to last two thirds of the beat, ended at %d", wr.Position())
+	}
+	m.play(wr, m.Notes[1])
+	if want := uint64(wr.MetricTicks.Ticks4th()); wr.Position() != want {
+		t.Errorf("Swung offbeat quaver expected to end on the beat, ended at %d", wr.Position())
+	}
+}
+
+func TestGrooveChordsAfterRest(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+	beat := wr.MetricTicks.Ticks4th()
+	m := &Melody{Scale: C, Mode: Ionian, TimeSignature: &TimeSignature{Numerator: 2, Denominator: 4}, Groove: Swing(wr, 2./3)}
+
+	m.BuildChords(wr, []*Note{{Note: C, Tone: 5, Duration: Quaver}}, I, nil)
+	m.BuildChords(wr, []*Note{{Note: Rest, Duration: Crochtet}}, I, nil)
+	if m.grooved != beat/2+beat {
+		t.Fatalf("Rest expected to move the groove on by a beat, got to %d", m.grooved)
+	}
+
+	// the chord after the rest starts on the swung offbeat and ends on the beat
+	onset := wr.Position()
+	m.BuildChords(wr, []*Note{{Note: C, Tone: 5, Duration: Quaver}}, I, nil)
+	if want := uint64(2*beat/3 + beat); onset != want {
+		t.Errorf("Chord after the rest expected to start at %d, got %d", want, onset)
+	}
+	if want := uint64(2 * beat); wr.Position() != want {
+		t.Errorf("Chord after the rest expected to end on the beat at %d, got %d", want, wr.Position())
+	}
+}
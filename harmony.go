@@ -0,0 +1,271 @@
+package main
+
+import (
+	"strings"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+type HarmonicFunction uint8
+
+const (
+	TonicFunction HarmonicFunction = iota
+	SubdominantFunction
+	DominantFunction
+)
+
+// measures of a phrase, phrases ending on a cadence
+const phraseMeasures = 4
+
+func (d Degree) Function() HarmonicFunction {
+	switch d {
+	case II, IV:
+		return SubdominantFunction
+	case V, VII:
+		return DominantFunction
+	}
+	return TonicFunction
+}
+
+func (m *Melody) DegreeOf(n *Note) Degree {
+	d := Degree(I)
+	switch n.Note {
+	case m.Second():
+		d = II
+	case m.Third():
+		d = III
+	case m.Quarte():
+		d = IV
+	case m.Quinte():
+		d = V
+	case m.Sixte():
+		d = VI
+	case m.Seventh():
+		d = VII
+	}
+	return d
+}
+
+func (m *Melody) chordsPerMeasure() int {
+	if m.HarmonicRhythm == 0 || !m.Functional {
+		return 1
+	}
+	return int(m.HarmonicRhythm)
+}
+
+// SplitHarmonicRhythm groups the notes of the measure by the chord they start
+// under
+func (m *Melody) SplitHarmonicRhythm(wr *writer.SMF, measure uint8) [][]*Note {
+	rhythm := m.chordsPerMeasure()
+	measureTicks := m.TimeSignature.MeasureTicks(wr)
+
+	slots := make([][]*Note, rhythm)
+	position := uint32(0)
+	for _, n := range m.Phrases[measure] {
+		slot := int(position * uint32(rhythm) / measureTicks)
+		if slot >= rhythm {
+			slot = rhythm - 1
+		}
+		slots[slot] = append(slots[slot], n)
+		position += n.Duration.Ticks(wr)
+	}
+	return slots
+}
+
+// transitionCost scores how naturally a chord moves to the next one, lower
+// being better
+func transitionCost(from, to Degree) float64 {
+	switch {
+	case from == to:
+		return 2
+	case from == II && to == V, from == IV && to == V, from == V && to == I, from == VII && to == I:
+		return 0
+	case from == IV && to == I: // plagal
+		return 1
+	case from == V && to == VI: // deceptive
+		return 1
+	}
+
+	costs := [3][3]float64{
+		// to tonic, subdominant, dominant
+		{1.5, 1, 1},   // from tonic
+		{3, 1.5, 0.5}, // from subdominant
+		{0.5, 5, 1.5}, // from dominant
+	}
+	return costs[from.Function()][to.Function()]
+}
+
+type cadence uint8
+
+const (
+	noCadence cadence = iota
+	halfCadence
+	authenticCadence
+	deceptiveCadence
+	finalCadence
+)
+
+// cadenceOf tells how the k-th measure of the melody closes its phrase:
+// phrases alternate half and authentic or deceptive cadences, the last one is
+// final
+func cadenceOf(hash string, k int, measures int) cadence {
+	phrase := k / phraseMeasures
+	switch {
+	case k == measures-1:
+		return finalCadence
+	case (k+1)%phraseMeasures != 0:
+		return noCadence
+	case phrase%2 == 0:
+		return halfCadence
+	case hash[phrase%len(hash)] == 'd' || hash[phrase%len(hash)] == '6':
+		return deceptiveCadence
+	}
+	return authenticCadence
+}
+
+// Harmonize chooses a degree for every chord of the harmonic rhythm. Chords
+// follow tonic, subdominant and dominant functions, fit the melody on strong
+// beats and close phrases on half, authentic or deceptive cadences.
+func (m *Melody) Harmonize(wr *writer.SMF) {
+	m.Progression = make(map[uint8][]Degree)
+
+	measures := make([]uint8, 0)
+	for i := uint8(1); i <= m.Measures; i++ {
+		if _, ok := m.Phrases[i]; ok {
+			measures = append(measures, i)
+		}
+	}
+
+	if !m.Functional {
+		for _, i := range measures {
+			m.Progression[i] = []Degree{m.DegreeOf(m.Phrases[i][0])}
+		}
+		return
+	}
+
+	hash := strings.TrimLeft(m.Hash, "0")
+	if len(hash) == 0 {
+		hash = "0"
+	}
+
+	type slot struct {
+		notes   []*Note
+		cadence cadence
+	}
+	slots := make([]slot, 0)
+	for k, i := range measures {
+		split := m.SplitHarmonicRhythm(wr, i)
+		for s, notes := range split {
+			sl := slot{notes: notes}
+			if s == len(split)-1 {
+				sl.cadence = cadenceOf(hash, k, len(measures))
+			}
+			slots = append(slots, sl)
+		}
+	}
+	if len(slots) == 0 {
+		return
+	}
+
+	fitCost := func(s int, d Degree) float64 {
+		cost := 0.
+		tones := m.Chord(d, nil, Crochtet).Tones()
+
+		position := uint32(0)
+		for _, n := range slots[s].notes {
+			weight := 0.
+			switch {
+			case position == 0:
+				weight = 3
+			case position%wr.MetricTicks.Ticks4th() == 0:
+				weight = 1
+			}
+			position += n.Duration.Ticks(wr)
+			if n.Note == Rest || weight == 0 {
+				continue
+			}
+
+			inChord := false
+			for _, t := range tones {
+				if t%12 == n.GetNoteTone()%12 {
+					inChord = true
+				}
+			}
+			if !inChord {
+				cost += 3 * weight
+			}
+		}
+
+		switch slots[s].cadence {
+		case halfCadence:
+			if d != V {
+				cost += 8
+			}
+		case authenticCadence:
+			if d != I {
+				cost += 8
+			}
+		case deceptiveCadence:
+			if d != VI {
+				cost += 8
+			}
+		case finalCadence:
+			if d != I {
+				cost += 20
+			}
+		}
+
+		// the chord before a closing cadence prepares it
+		if s+1 < len(slots) {
+			switch slots[s+1].cadence {
+			case authenticCadence, deceptiveCadence, finalCadence:
+				if d != V {
+					cost += 2
+				}
+			}
+		}
+
+		if s == 0 && d != I {
+			cost += 2
+		}
+
+		// the hash settles otherwise equal choices
+		return cost + 0.1*float64((int(hash[s%len(hash)])+int(d))%3)
+	}
+
+	costs := make([][7]float64, len(slots))
+	from := make([][7]Degree, len(slots))
+	for d := Degree(I); d <= VII; d++ {
+		costs[0][d] = fitCost(0, d)
+	}
+	for s := 1; s < len(slots); s++ {
+		for d := Degree(I); d <= VII; d++ {
+			best := -1.
+			for p := Degree(I); p <= VII; p++ {
+				if c := costs[s-1][p] + transitionCost(p, d); best < 0 || c < best {
+					best, from[s][d] = c, p
+				}
+			}
+			costs[s][d] = best + fitCost(s, d)
+		}
+	}
+
+	degrees := make([]Degree, len(slots))
+	last := len(slots) - 1
+	for d := Degree(I); d <= VII; d++ {
+		if costs[last][d] < costs[last][degrees[last]] {
+			degrees[last] = d
+		}
+	}
+	for s := last; s > 0; s-- {
+		degrees[s-1] = from[s][degrees[s]]
+	}
+
+	s := 0
+	for _, i := range measures {
+		for range m.SplitHarmonicRhythm(wr, i) {
+			m.Progression[i] = append(m.Progression[i], degrees[s])
+			s++
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+func TestHarmonizeCIonianPeriod(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+	m := NewMelody("cc00")
+	m.TimeSignature = &TimeSignature{Numerator: 4, Denominator: 4}
+	m.Functional = true
+	m.Phrases = make(map[uint8][]*Note)
+
+	for i, n := range []int32{C, F, A, D, E, A, D, C} {
+		m.Phrases[uint8(i+1)] = []*Note{{Note: n, Tone: 5, Duration: Semibreve}}
+	}
+	m.Measures = 8
+
+	m.Harmonize(wr)
+
+	if d := m.Progression[1][0]; d != I {
+		t.Errorf("Period expected to open on I, got %d", d)
+	}
+	if d := m.Progression[4][0]; d != V {
+		t.Errorf("Antecedent expected to end on a half cadence, got %d", d)
+	}
+	if d := m.Progression[7][0]; d.Function() != DominantFunction {
+		t.Errorf("Final cadence expected to be prepared by a dominant, got %d", d)
+	}
+	if d := m.Progression[8][0]; d != I {
+		t.Errorf("Period expected to close on I, got %d", d)
+	}
+
+	for i := uint8(1); i <= m.Measures; i++ {
+		d := m.Progression[i][0]
+		n := m.Phrases[i][0]
+		inChord := false
+		for _, tone := range m.Chord(d, nil, Crochtet).Tones() {
+			if tone%12 == n.GetNoteTone()%12 {
+				inChord = true
+			}
+		}
+		if !inChord {
+			t.Errorf("Measure %d chord %d expected to hold the melody note %d", i, d, n.Note)
+		}
+	}
+}
+
+func TestHarmonicRhythm(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+	m := NewMelody("cc00")
+	m.TimeSignature = &TimeSignature{Numerator: 4, Denominator: 4}
+	m.Functional = true
+	m.HarmonicRhythm = 2
+	m.Phrases = map[uint8][]*Note{
+		1: {{Note: C, Tone: 5, Duration: Minim}, {Note: F, Tone: 5, Duration: Minim}},
+		2: {{Note: D, Tone: 5, Duration: Minim}, {Note: C, Tone: 5, Duration: Minim}},
+	}
+	m.Measures = 2
+
+	m.Harmonize(wr)
+
+	for i := uint8(1); i <= m.Measures; i++ {
+		if len(m.Progression[i]) != 2 {
+			t.Fatalf("Measure %d expected to hold two chords, got %v", i, m.Progression[i])
+		}
+	}
+	if m.Progression[1][1] == m.Progression[1][0] {
+		t.Errorf("Measure 1 expected to change chord on its third beat, got %v", m.Progression[1])
+	}
+	if d := m.Progression[2][1]; d != I {
+		t.Errorf("Last chord expected to be I, got %d", d)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"hash/fnv"
+	"math/rand"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+// Humanizer nudges notes as a player would: a little late, a little short and
+// never twice as loud. Seeded from the block hash, the same block always plays
+// the same way.
+type Humanizer struct {
+	Timing   uint32 // most ticks a note starts after the beat
+	Duration uint32 // most ticks a note is shortened
+	Velocity int32  // most a velocity moves either way
+
+	rand *rand.Rand
+}
+
+func NewHumanizer(hash string, timing, duration uint32, velocity int32) *Humanizer {
+	seed := fnv.New64a()
+	seed.Write([]byte(hash))
+	return &Humanizer{
+		Timing:   timing,
+		Duration: duration,
+		Velocity: velocity,
+		rand:     rand.New(rand.NewSource(int64(seed.Sum64()))),
+	}
+}
+
+func (h *Humanizer) ticks(most uint32) uint32 {
+	if most == 0 {
+		return 0
+	}
+	return uint32(h.rand.Int63n(int64(most) + 1))
+}
+
+func (h *Humanizer) velocity(v int32) int32 {
+	if h.Velocity == 0 {
+		return v
+	}
+	return clampVelocity(v + int32(h.rand.Int63n(2*int64(h.Velocity)+1)) - h.Velocity)
+}
+
+// nudge splits the length of a note between the delay before it sounds, the
+// time it sounds and the time it is released early, sounding at least half
+func (h *Humanizer) nudge(length uint32) (uint32, uint32, uint32) {
+	delay, cut := h.ticks(h.Timing), h.ticks(h.Duration)
+	for delay+cut > length/2 {
+		delay, cut = delay/2, cut/2
+	}
+	return delay, length - delay - cut, cut
+}
+
+// forward moves the track on by the ticks given. The writer replaces a delta
+// no event has carried yet, so a forward from the position the last one was
+// set at adds to it.
+func (m *Melody) forward(wr *writer.SMF, ticks uint32) {
+	if ticks == 0 {
+		return
+	}
+	if m.pending > 0 && m.forwarded == wr.Position() {
+		ticks += m.pending
+	}
+	m.forwarded, m.pending = wr.Position(), ticks
+	writer.Forward(wr, 0, ticks, wr.MetricTicks.Ticks4th()*4)
+}
+
+// strike plays the chord for the length given, nudged as a whole when the
+// harmony is humanized, every voice at its own velocity
+func (m *Melody) strike(wr *writer.SMF, c *Chord, length uint32) {
+	h := m.HarmonyHumanize
+	delay, sound, cut := uint32(0), length, uint32(0)
+	if h != nil {
+		delay, sound, cut = h.nudge(length)
+	}
+	m.forward(wr, delay)
+	for _, n := range c.Notes {
+		velocity := n.Velocity
+		if h != nil {
+			velocity = h.velocity(velocity)
+		}
+		writer.NoteOn(wr, uint8(n.GetNoteTone()), uint8(velocity))
+	}
+	m.forward(wr, m.press(wr, sound))
+	for _, n := range c.Notes {
+		writer.NoteOff(wr, uint8(n.GetNoteTone()))
+	}
+	m.forward(wr, cut)
+}
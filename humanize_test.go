@@ -0,0 +1,68 @@
+package main
+
+import (
+	"io"
+	"testing"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+func TestHumanizerReproducible(t *testing.T) {
+	hash := "00000000000000000003efccdd987dd6d93ba18327eef8fd4b46d0de863eb14c"
+	a, b := NewHumanizer(hash, 24, 48, 8), NewHumanizer(hash, 24, 48, 8)
+	other := NewHumanizer("000000000000000000051f8864b8eddf483e7d2b941d626ecea1de70fa0bf551", 24, 48, 8)
+
+	differs := false
+	for i := 0; i < 16; i++ {
+		delay, sound, cut := a.nudge(960)
+		d, s, c := b.nudge(960)
+		if delay != d || sound != s || cut != c {
+			t.Fatalf("Same block expected to be nudged alike, got %d/%d/%d and %d/%d/%d", delay, sound, cut, d, s, c)
+		}
+		if delay > 24 || cut > 48 || delay+sound+cut != 960 {
+			t.Errorf("Nudge %d/%d/%d expected to stay within the amounts and keep the length", delay, sound, cut)
+		}
+		if od, _, oc := other.nudge(960); od != delay || oc != cut {
+			differs = true
+		}
+	}
+	if !differs {
+		t.Errorf("Other blocks expected to be nudged differently")
+	}
+}
+
+func TestHumanizerKeepsGrid(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+	m := &Melody{Humanize: NewHumanizer("3efccdd9", 24, 48, 8)}
+
+	beat := uint64(NoteDuration(Crochtet).Ticks(wr))
+	for i := 0; i < 8; i++ {
+		m.play(wr, &Note{Note: C, Tone: 5, Velocity: 100, Duration: Crochtet})
+		if want := uint64(i+1) * beat; wr.Position() > want {
+			t.Fatalf("Note %d expected to end by the grid at %d, got %d", i, want, wr.Position())
+		}
+	}
+
+	// the time notes are shortened by is carried by the next event
+	wr.Silence(0, true)
+	if wr.Position() != 8*beat {
+		t.Errorf("Notes expected to keep the grid up to %d, got %d", 8*beat, wr.Position())
+	}
+}
+
+func TestForwardAddsUpPerTrack(t *testing.T) {
+	a, b := writer.NewSMF(io.Discard, 1), writer.NewSMF(io.Discard, 1)
+	ma, mb := &Melody{}, &Melody{}
+
+	// forwards on two writers interleave, each adding up until an event
+	ma.forward(a, 100)
+	mb.forward(b, 30)
+	ma.forward(a, 20)
+	mb.forward(b, 5)
+	writer.NoteOn(a, 60, 100)
+	writer.NoteOn(b, 60, 100)
+
+	if a.Position() != 120 || b.Position() != 35 {
+		t.Errorf("Forwards expected to reach 120 and 35, got %d and %d", a.Position(), b.Position())
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+// GMInstruments names the General MIDI programs, by number
+var GMInstruments = [128]string{
+	"Acoustic Grand Piano", "Bright Acoustic Piano", "Electric Grand Piano", "Honky-tonk Piano",
+	"Electric Piano 1", "Electric Piano 2", "Harpsichord", "Clavinet",
+	"Celesta", "Glockenspiel", "Music Box", "Vibraphone",
+	"Marimba", "Xylophone", "Tubular Bells", "Dulcimer",
+	"Drawbar Organ", "Percussive Organ", "Rock Organ", "Church Organ",
+	"Reed Organ", "Accordion", "Harmonica", "Tango Accordion",
+	"Acoustic Guitar (nylon)", "Acoustic Guitar (steel)", "Electric Guitar (jazz)", "Electric Guitar (clean)",
+	"Electric Guitar (muted)", "Overdriven Guitar", "Distortion Guitar", "Guitar Harmonics",
+	"Acoustic Bass", "Electric Bass (finger)", "Electric Bass (pick)", "Fretless Bass",
+	"Slap Bass 1", "Slap Bass 2", "Synth Bass 1", "Synth Bass 2",
+	"Violin", "Viola", "Cello", "Contrabass",
+	"Tremolo Strings", "Pizzicato Strings", "Orchestral Harp", "Timpani",
+	"String Ensemble 1", "String Ensemble 2", "Synth Strings 1", "Synth Strings 2",
+	"Choir Aahs", "Voice Oohs", "Synth Voice", "Orchestra Hit",
+	"Trumpet", "Trombone", "Tuba", "Muted Trumpet",
+	"French Horn", "Brass Section", "Synth Brass 1", "Synth Brass 2",
+	"Soprano Sax", "Alto Sax", "Tenor Sax", "Baritone Sax",
+	"Oboe", "English Horn", "Bassoon", "Clarinet",
+	"Piccolo", "Flute", "Recorder", "Pan Flute",
+	"Blown Bottle", "Shakuhachi", "Whistle", "Ocarina",
+	"Lead 1 (square)", "Lead 2 (sawtooth)", "Lead 3 (calliope)", "Lead 4 (chiff)",
+	"Lead 5 (charang)", "Lead 6 (voice)", "Lead 7 (fifths)", "Lead 8 (bass + lead)",
+	"Pad 1 (new age)", "Pad 2 (warm)", "Pad 3 (polysynth)", "Pad 4 (choir)",
+	"Pad 5 (bowed)", "Pad 6 (metallic)", "Pad 7 (halo)", "Pad 8 (sweep)",
+	"FX 1 (rain)", "FX 2 (soundtrack)", "FX 3 (crystal)", "FX 4 (atmosphere)",
+	"FX 5 (brightness)", "FX 6 (goblins)", "FX 7 (echoes)", "FX 8 (sci-fi)",
+	"Sitar", "Banjo", "Shamisen", "Koto",
+	"Kalimba", "Bagpipe", "Fiddle", "Shanai",
+	"Tinkle Bell", "Agogo", "Steel Drums", "Woodblock",
+	"Taiko Drum", "Melodic Tom", "Synth Drum", "Reverse Cymbal",
+	"Guitar Fret Noise", "Breath Noise", "Seashore", "Bird Tweet",
+	"Telephone Ring", "Helicopter", "Applause", "Gunshot",
+}
+
+// GMDrumKits are the programs of the percussion channel, by name
+var GMDrumKits = map[string]uint8{
+	"Standard Kit": 0, "Room Kit": 8, "Power Kit": 16, "Electronic Kit": 24,
+	"TR-808 Kit": 25, "Jazz Kit": 32, "Brush Kit": 40, "Orchestra Kit": 48,
+}
+
+// bank of the General MIDI 2 drum kits
+const drumBank uint8 = 120
+
+// partInstruments are the instruments the hash picks from for every part
+var partInstruments = map[string][]string{
+	"Lead":         {"Flute", "Violin", "Clarinet", "Oboe", "Trumpet", "Alto Sax", "Lead 1 (square)", "Vibraphone"},
+	"Harmony":      {"Acoustic Grand Piano", "Electric Piano 1", "String Ensemble 1", "Drawbar Organ", "Acoustic Guitar (nylon)", "Orchestral Harp"},
+	"Counterpoint": {"Cello", "Bassoon", "French Horn", "Viola", "Trombone"},
+	"Doubling":     {"Clarinet", "Viola", "Alto Sax", "French Horn", "Oboe"},
+	"Bass":         {"Acoustic Bass", "Electric Bass (finger)", "Fretless Bass", "Synth Bass 1"},
+	"Pad":          {"Pad 2 (warm)", "Pad 1 (new age)", "Pad 4 (choir)", "Pad 7 (halo)", "String Ensemble 2"},
+	"Percussions":  {"Standard Kit", "Room Kit", "Jazz Kit", "Brush Kit", "TR-808 Kit"},
+}
+
+// Patch is the sound a channel plays: a program of a bank
+type Patch struct {
+	Name    string
+	Program uint8
+	Bank    uint8
+}
+
+// GMPatch finds the General MIDI instrument or drum kit by its name, whatever
+// its case
+func GMPatch(name string) (Patch, error) {
+	for program, instrument := range GMInstruments {
+		if strings.EqualFold(instrument, name) {
+			return Patch{Name: instrument, Program: uint8(program)}, nil
+		}
+	}
+	for kit, program := range GMDrumKits {
+		if strings.EqualFold(kit, name) {
+			return Patch{Name: kit, Program: program, Bank: drumBank}, nil
+		}
+	}
+	return Patch{}, fmt.Errorf("unknown General MIDI instrument %q", name)
+}
+
+// Patch is the instrument chosen for the part, or the one the hash of the
+// first section picks among the instruments of the part
+func (s *Song) Patch(part string) (Patch, error) {
+	if name, ok := s.Instruments[part]; ok {
+		return GMPatch(name)
+	}
+	return s.pickPatch(part)
+}
+
+// pickPatch picks by the hash among the instruments of the part
+func (s *Song) pickPatch(part string) (Patch, error) {
+	choices := partInstruments[part]
+	if len(choices) == 0 {
+		return Patch{}, fmt.Errorf("no instrument for part %q", part)
+	}
+	hash := ""
+	if len(s.Sections) > 0 {
+		hash = strings.TrimLeft(s.Sections[0].Melody.Hash, "0")
+	}
+	pick := len(part)
+	for _, c := range hash {
+		pick += int(c)
+	}
+	return GMPatch(choices[pick%len(choices)])
+}
+
+// Select names the track after the part and switches its channel to the
+// patch
+func (p Patch) Select(wr *writer.SMF, part string) {
+	writer.Instrument(wr, part)
+	writer.ControlChange(wr, 0, p.Bank)
+	writer.ControlChange(wr, 32, 0)
+	writer.ProgramChange(wr, p.Program)
+}
+
+// SelectPatch selects the patch of the part on the channel of the track
+func (s *Song) SelectPatch(wr *writer.SMF, part string) error {
+	p, err := s.Patch(part)
+	if err != nil {
+		return err
+	}
+	p.Select(wr, part)
+	return nil
+}
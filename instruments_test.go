@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestGMPatch(t *testing.T) {
+	for name, want := range map[string]Patch{
+		"acoustic grand piano": {Name: "Acoustic Grand Piano", Program: 0},
+		"Cello":                {Name: "Cello", Program: 42},
+		"Gunshot":              {Name: "Gunshot", Program: 127},
+		"Brush Kit":            {Name: "Brush Kit", Program: 40, Bank: drumBank},
+	} {
+		p, err := GMPatch(name)
+		if err != nil || p != want {
+			t.Errorf("%s expected to be %+v, got %+v (%v)", name, want, p, err)
+		}
+	}
+	if _, err := GMPatch("Theremin"); err == nil {
+		t.Errorf("Unknown instrument expected to fail")
+	}
+}
+
+func TestSongPatch(t *testing.T) {
+	s := &Song{
+		Sections:    []*Section{{Melody: &Melody{Hash: "0003efccdd"}}},
+		Instruments: map[string]string{"Lead": "Oboe"},
+	}
+
+	if p, err := s.Patch("Lead"); err != nil || p.Program != 68 {
+		t.Errorf("Chosen instrument expected to be the oboe, got %+v (%v)", p, err)
+	}
+
+	p, err := s.Patch("Bass")
+	if err != nil {
+		t.Fatalf("Bass expected a patch, got %v", err)
+	}
+	if q, _ := s.Patch("Bass"); q != p {
+		t.Errorf("Same hash expected to pick the same bass, got %+v and %+v", p, q)
+	}
+	if p.Program < 32 || p.Program > 39 {
+		t.Errorf("Bass expected to be picked among the basses, got %+v", p)
+	}
+	if _, err := s.Patch("Kazoo"); err == nil {
+		t.Errorf("Unknown part expected to fail")
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
+	"os"
 	"regexp"
 	"sort"
 	"strings"
@@ -44,14 +47,105 @@ const (
 
 type NoteDuration uint32
 
+// Dotted marks a duration lengthened by half of its value
+const Dotted NoteDuration = 1 << 8
+
+const (
+	Semibreve            NoteDuration = 1
+	Minim                             = 2
+	Crochtet                          = 4
+	CrochtetTriplet                   = 6
+	Quaver                            = 8
+	QuaverTriplet                     = 12
+	Semiquaver                        = 16
+	SemiquaverQuintuplet              = 20
+	SemiquaverTriplet                 = 24
+	Demisemiquaver                    = 32
+)
+
 const (
-	Minim       NoteDuration = 2
-	CrochtetDot              = 3
-	Crochtet                 = 4
-	Quaver                   = 8
-	Semiquaver               = 16
+	MinimDot    = Minim | Dotted
+	CrochtetDot = Crochtet | Dotted
+	QuaverDot   = Quaver | Dotted
 )
 
+// Ratio returns the duration as a fraction of a whole note
+func (d NoteDuration) Ratio() (uint32, uint32) {
+	if d&Dotted != 0 {
+		return 3, uint32(d&^Dotted) * 2
+	}
+	return 1, uint32(d)
+}
+
+// TupletSize returns how many notes are needed to complete the tuplet group
+func (d NoteDuration) TupletSize() int {
+	switch d {
+	case CrochtetTriplet, QuaverTriplet, SemiquaverTriplet:
+		return 3
+	case SemiquaverQuintuplet:
+		return 5
+	}
+	return 1
+}
+
+func (d NoteDuration) Ticks(wr *writer.SMF) uint32 {
+	num, denom := d.Ratio()
+	return wr.MetricTicks.Ticks4th() * 4 * num / denom
+}
+
+var durations = []NoteDuration{
+	Semibreve,
+	MinimDot,
+	Minim,
+	CrochtetDot,
+	Crochtet,
+	QuaverDot,
+	CrochtetTriplet,
+	Quaver,
+	QuaverTriplet,
+	Semiquaver,
+	SemiquaverQuintuplet,
+	SemiquaverTriplet,
+	Demisemiquaver,
+}
+
+// fitDurations splits ticks into as few durations as possible, longest first,
+// and returns the ticks no duration can express
+func fitDurations(ticks uint32, wr *writer.SMF) ([]NoteDuration, uint32) {
+	for pieces := 1; pieces <= 4; pieces++ {
+		if fitted, ok := fitExactly(ticks, pieces, durations, wr); ok {
+			return fitted, 0
+		}
+	}
+
+	fitted := make([]NoteDuration, 0)
+	for _, d := range durations {
+		for dt := d.Ticks(wr); ticks >= dt; ticks -= dt {
+			fitted = append(fitted, d)
+		}
+	}
+	return fitted, ticks
+}
+
+func fitExactly(ticks uint32, pieces int, from []NoteDuration, wr *writer.SMF) ([]NoteDuration, bool) {
+	if ticks == 0 {
+		return []NoteDuration{}, true
+	}
+	if pieces == 0 {
+		return nil, false
+	}
+	for i, d := range from {
+		dt := d.Ticks(wr)
+		if dt > ticks {
+			continue
+		}
+		if fitted, ok := fitExactly(ticks-dt, pieces-1, from[i:], wr); ok {
+			return append([]NoteDuration{d}, fitted...), true
+		}
+	}
+	return nil, false
+}
+
 type TimeSignature struct {
 	Numerator   uint8
 	Denominator uint8
@@ -71,20 +165,10 @@ func NewTimeSignature(hash string) *TimeSignature {
 }
 
 func (ts *TimeSignature) GetTicksOfDuration(d NoteDuration, wr *writer.SMF) float64 {
-	resolution := float64(wr.MetricTicks.Resolution())
-	switch d {
-	case Minim:
-		return (float64(wr.MetricTicks.Ticks4th()) * 2) / resolution
-	case CrochtetDot:
-		return (float64(wr.MetricTicks.Ticks4th()) + float64(wr.MetricTicks.Ticks8th())) / resolution
-	case Crochtet:
-		return float64(wr.MetricTicks.Ticks4th()) / resolution
-	case Quaver:
-		return float64(wr.MetricTicks.Ticks8th()) / resolution
-	case Semiquaver:
-		return float64(wr.MetricTicks.Ticks16th()) / resolution
-	}
-	return 0.
+	return float64(d.Ticks(wr)) / float64(wr.MetricTicks.Resolution())
+}
+func (ts *TimeSignature) MeasureTicks(wr *writer.SMF) uint32 {
+	return wr.MetricTicks.Ticks4th() * 4 * uint32(ts.Numerator) / uint32(ts.Denominator)
 }
 func (ts *TimeSignature) MetricMeasureDuration() float64 {
 	return float64(ts.Numerator) / float64(ts.Denominator)
@@ -95,32 +179,54 @@ type Note struct {
 	Velocity int32
 	Duration NoteDuration
 	Tone     int32
+	Tie      *Note // continuation over the barline, sounded as one note
+	Tied     bool  // already sounded by the note tied to it
+
+	Articulation Articulation
 }
 
 func (n *Note) Play(wr *writer.SMF) {
+	if n.Tied {
+		return
+	}
+
+	// rests end by a silence, so the time they keep is written before the
+	// next note
 	if n.Note == Rest {
+		n.ApplyMeterDuration(wr)
 		wr.Silence(int8(wr.Channel()), true)
-	} else {
-		writer.NoteOn(wr, uint8(n.GetNoteTone()), uint8(n.Velocity))
+		return
 	}
 
+	writer.NoteOn(wr, uint8(n.GetNoteTone()), uint8(n.Velocity))
 	n.ApplyMeterDuration(wr)
 	writer.NoteOff(wr, uint8(n.GetNoteTone()))
 }
 
 func (n *Note) ApplyMeterDuration(wr *writer.SMF) {
-	switch n.Duration {
-	case CrochtetDot:
-		writer.Forward(wr, 0, 3, Quaver)
-	default:
-		writer.Forward(wr, 0, 1, uint32(n.Duration))
+	writer.Forward(wr, 0, n.TiedTicks(wr), wr.MetricTicks.Ticks4th()*4)
+}
+
+func (n *Note) TiedTicks(wr *writer.SMF) uint32 {
+	ticks := uint32(0)
+	for t := n; t != nil; t = t.Tie {
+		ticks += t.Duration.Ticks(wr)
 	}
+	return ticks
 }
 
 type Chord struct {
 	Notes []*Note
 }
 
+func (c *Chord) Tones() []int32 {
+	tones := make([]int32, 0)
+	for _, n := range c.Notes {
+		tones = append(tones, n.GetNoteTone())
+	}
+	return tones
+}
+
 func (c *Chord) Play(wr *writer.SMF) {
 	for _, n := range c.Notes {
 		writer.NoteOn(wr, uint8(n.GetNoteTone()), uint8(n.Velocity))
@@ -142,6 +248,37 @@ type Melody struct {
 	TimeSignature *TimeSignature
 	Measures      uint8
 	Phrases       map[uint8][]*Note
+	Ties          bool // tie notes over the barline instead of shortening them
+
+	Hash           string
+	Silent         bool  // keep the time of the notes without sounding them
+	ExtendedChords bool  // let the hash colour chords with sevenths and extensions
+	Inversions     bool  // invert chords so the bass moves by step
+	VoiceLeading   bool  // voice each chord from the previous one
+	Dynamics       bool  // shape velocities instead of striking every note alike
+	Register       Range // the range the notes were folded into
+
+	Humanize        *Humanizer // nudges the notes of the melody
+	HarmonyHumanize *Humanizer // nudges the chords of the harmony
+	Groove          *Groove    // moves the notes off the straight grid
+	BassStyle       BassStyle
+	Arpeggio        Arpeggio // breaks the chords of the harmony
+	Drone           bool     // the pad holds the tonic and its fifth instead of the chords
+	Octaves         int32    // octaves the harmony, bass and pad are moved by into the register of their part
+	Doubling        int      // scale steps the harmony voice doubles the melody at, none when zero
+	Sustain         bool     // the harmony is pedalled, the pedal changing with the chords
+	Swell           bool     // the expression swells over every phrase
+
+	Functional     bool  // follow harmonic functions instead of the first note of each measure
+	HarmonicRhythm uint8 // chords per measure
+	Progression    map[uint8][]Degree
+
+	chordVelocity int32  // velocity of the top note of the chords being built
+	lifted        bool   // the sustain pedal is up until the next chord sounds
+	grooved       uint32 // ticks of the track played so far by the groove
+	forwarded     uint64 // position of the track the pending ticks were forwarded from
+	pending       uint32 // ticks forwarded that no event has carried yet
+	held          *Note  // legato note sounding until the next one
 }
 
 func NewMelody(hash string) *Melody {
@@ -242,6 +379,7 @@ loop_mode:
 
 	ts := NewTimeSignature(hash)
 	melody := &Melody{
+		Hash:          hash,
 		Notes:         make([]*Note, 0),
 		Mode:          mode,
 		Scale:         scale,
@@ -281,18 +419,42 @@ loop_mode:
 					noteDurationForPhrase = Crochtet
 					break loop_duration
 				case '3':
-					fallthrough
-				case '4':
 					noteDurationForPhrase = Quaver
 					break loop_duration
+				case '4':
+					noteDurationForPhrase = QuaverTriplet
+					break loop_duration
 				case '5':
 					noteDurationForPhrase = Semiquaver
 					break loop_duration
 				case '6':
-					noteDurationForPhrase = Semiquaver
+					noteDurationForPhrase = Demisemiquaver
+					break loop_duration
+				case '7':
+					noteDurationForPhrase = Semibreve
+					break loop_duration
+				case '8':
+					noteDurationForPhrase = MinimDot
+					break loop_duration
+				case '9':
+					noteDurationForPhrase = QuaverDot
+					break loop_duration
+				case 'b':
+					noteDurationForPhrase = SemiquaverTriplet
+					break loop_duration
+				case 'd':
+					noteDurationForPhrase = CrochtetTriplet
+					break loop_duration
+				case 'e':
+					noteDurationForPhrase = SemiquaverQuintuplet
 					break loop_duration
 				}
 			}
+
+			// a tuplet is only heard as such when its group is complete
+			if size := noteDurationForPhrase.TupletSize(); notePerPhrase%size != 0 {
+				notePerPhrase += size - notePerPhrase%size
+			}
 		}
 
 		switch indexOfC {
@@ -420,6 +582,9 @@ type ChordAlteration struct {
 	Sus        bool
 	SusFour    bool
 	Reverse    uint8
+	SlashBass  bool
+	Bass       Degree
+	Octave     int32
 }
 
 type Degree uint8
@@ -434,118 +599,363 @@ const (
 	VII
 )
 
+func (m *Melody) ScaleStep(step int) (int32, int32) {
+	notes := []int32{m.Tonic(), m.Second(), m.Third(), m.Quarte(), m.Quinte(), m.Sixte(), m.Seventh()}
+	return notes[step%7], int32(step / 7)
+}
+
+// Interval returns the semitones between the root of the degree and the scale
+// step above it
+func (m *Melody) Interval(d Degree, step int) int32 {
+	root, rootOctave := m.ScaleStep(int(d))
+	n, octave := m.ScaleStep(int(d) + step)
+	return n - root + 12*(octave-rootOctave)
+}
+
+func (m *Melody) Chord(d Degree, alt *ChordAlteration, duration NoteDuration) *Chord {
+	if alt == nil {
+		alt = &ChordAlteration{}
+	}
+
+	// the octave climbed goes to the tone so no chord note reads as a rest
+	tone := func(step int) *Note {
+		n, octave := m.ScaleStep(int(d) + step)
+		return &Note{Note: n % 12, Tone: 3 + octave + n/12, Duration: duration, Velocity: 100}
+	}
+	root := tone(0)
+	above := func(semitones int32) *Note {
+		n := root.Note + semitones
+		return &Note{Note: n % 12, Tone: root.Tone + n/12, Duration: duration, Velocity: 100}
+	}
+
+	third, fifth := tone(2), tone(4)
+	switch {
+	case alt.Sus:
+		third = tone(1)
+	case alt.SusFour:
+		third = tone(3)
+	case alt.Aug, alt.Dom:
+		third = above(4)
+	case alt.Dim:
+		third = above(3)
+	}
+	switch {
+	case alt.Aug, alt.FifthAug:
+		fifth = above(8)
+	case alt.Dim:
+		fifth = above(6)
+	case alt.Dom:
+		fifth = above(7)
+	}
+
+	chord := &Chord{Notes: []*Note{root, third, fifth}}
+
+	// extensions are stacked over the seventh
+	extended := alt.Ninth || alt.NinthMin || alt.NinthAug || alt.Eleven || alt.Thirteenth
+	if alt.Seven || alt.SevenMaj || alt.Dom || extended {
+		seventh := tone(6)
+		switch {
+		case alt.SevenMaj:
+			seventh = above(11)
+		case alt.Dom:
+			seventh = above(10)
+		case alt.Dim && alt.Seven:
+			seventh = above(9)
+		}
+		chord.Notes = append(chord.Notes, seventh)
+	}
+
+	switch {
+	case alt.NinthMin:
+		chord.Notes = append(chord.Notes, above(13))
+	case alt.NinthAug:
+		chord.Notes = append(chord.Notes, above(15))
+	case extended:
+		chord.Notes = append(chord.Notes, tone(8))
+	}
+	if alt.Eleven {
+		chord.Notes = append(chord.Notes, tone(10))
+	}
+	if alt.Thirteenth {
+		chord.Notes = append(chord.Notes, tone(12))
+	}
+
+	rootTone := root.GetNoteTone()
+	for k := 0; k < int(alt.Reverse) && k < len(chord.Notes)-1; k++ {
+		chord.Notes[k].Tone++
+	}
+	sort.Slice(chord.Notes, func(i, j int) bool {
+		return chord.Notes[i].GetNoteTone() < chord.Notes[j].GetNoteTone()
+	})
+	// inverted chords stay around the root instead of climbing
+	if chord.Notes[0].GetNoteTone()-rootTone > 6 {
+		for _, n := range chord.Notes {
+			n.Tone--
+		}
+	}
+
+	if alt.SlashBass {
+		n, octave := m.ScaleStep(int(alt.Bass))
+		bass := &Note{Note: n, Tone: 3 + octave, Duration: duration, Velocity: 100}
+		for bass.GetNoteTone() >= chord.Notes[0].GetNoteTone() {
+			bass.Tone--
+		}
+		chord.Notes = append([]*Note{bass}, chord.Notes...)
+	}
+
+	for _, n := range chord.Notes {
+		n.Tone += alt.Octave
+	}
+
+	return chord
+}
+
+// Invert sets the inversion that brings the bass of the chord closest to the
+// previous one, so the bass line moves by step where it can
+func (m *Melody) Invert(d Degree, alt *ChordAlteration, prevBass int32) *ChordAlteration {
+	if alt == nil {
+		alt = &ChordAlteration{}
+	}
+	if alt.SlashBass {
+		return alt
+	}
+
+	best, bestMotion := uint8(0), int32(-1)
+	for k := uint8(0); k < uint8(len(m.Chord(d, alt, Crochtet).Notes)); k++ {
+		alt.Reverse = k
+		motion := m.Chord(d, alt, Crochtet).Notes[0].GetNoteTone() - prevBass
+		if motion < 0 {
+			motion = -motion
+		}
+		if bestMotion < 0 || motion < bestMotion {
+			best, bestMotion = k, motion
+		}
+	}
+	alt.Reverse = best
+	return alt
+}
+
 func (m *Melody) BuildChord(wr *writer.SMF, d Degree, alt *ChordAlteration, duration NoteDuration) {
-	var chord Chord
+	c := m.Chord(d, alt, duration)
+	for _, n := range c.Notes {
+		n.Tone += m.Octaves
+	}
+	if m.Dynamics {
+		c.Balance(m.chordVelocity)
+	}
+	length := m.groove(duration.Ticks(wr))
+	if m.Arpeggio != Block && len(c.Notes) > 0 {
+		m.arpeggiate(wr, c, length)
+		return
+	}
+	m.strike(wr, c, length)
+}
 
-	var f, t, q Note
-	f.Tone, t.Tone, q.Tone = 3, 3, 3
-	f.Duration, t.Duration, q.Duration = duration, duration, duration
-	switch d {
-	case I:
-		f.Note = m.Tonic()
-		t.Note = m.Third()
-		q.Note = m.Quinte()
-	case II:
-		f.Note = m.Second()
-		t.Note = m.Quarte()
-		q.Note = m.Sixte()
-	case III:
-		f.Note = m.Third()
-		t.Note = m.Quinte()
-		q.Note = m.Seventh()
-	case IV:
-		f.Note = m.Quarte()
-		t.Note = m.Sixte()
-		q.Note = m.Tonic()
-		q.Tone++
-	case V:
-		f.Note = m.Quinte()
-		t.Note = m.Seventh()
-		q.Note = m.Second()
-		q.Tone++
-	case VI:
-		f.Note = m.Sixte()
-		t.Note = m.Tonic()
-		t.Tone++
-		q.Note = m.Third()
-		q.Tone++
-	case VII:
-		f.Note = m.Seventh()
-		t.Note = m.Second()
-		t.Tone++
-		q.Note = m.Quarte()
-		q.Tone++
-	}
-
-	f.Velocity, t.Velocity, q.Velocity = 100, 100, 100
-
-	chord.Notes = append(chord.Notes, &f)
-	chord.Notes = append(chord.Notes, &t)
-	chord.Notes = append(chord.Notes, &q)
-
-	chord.Play(wr)
+// AlterationFor picks from the hash how the chord of the measure is coloured,
+// keeping only the extensions the scale gives a consonant interval to
+func (m *Melody) AlterationFor(d Degree, measure uint8) *ChordAlteration {
+	hash := strings.TrimLeft(m.Hash, "0")
+	if !m.ExtendedChords || len(hash) == 0 {
+		return nil
+	}
+
+	majorNinth := m.Interval(d, 8) == 14
+	minorThird := m.Interval(d, 2) == 3
+	perfectFifth := m.Interval(d, 4) == 7
+
+	switch hash[int(measure)%len(hash)] {
+	case '8', 'c':
+		return &ChordAlteration{Seven: true}
+	case '9':
+		if d == V {
+			return &ChordAlteration{Dom: true}
+		}
+		return &ChordAlteration{Seven: true}
+	case 'a':
+		if (d == I || d == V) && perfectFifth {
+			return &ChordAlteration{SusFour: true}
+		}
+	case 'b':
+		if majorNinth {
+			return &ChordAlteration{Ninth: true}
+		}
+	case 'd':
+		// the eleventh rubs against a major third
+		if majorNinth && minorThird && m.Interval(d, 10) == 17 {
+			return &ChordAlteration{Eleven: true}
+		}
+		return &ChordAlteration{Seven: true}
+	case 'e':
+		if majorNinth && m.Interval(d, 12) == 21 {
+			return &ChordAlteration{Thirteenth: true}
+		}
+	case 'f':
+		if majorNinth && perfectFifth {
+			return &ChordAlteration{Sus: true}
+		}
+	}
+	return nil
 }
 
 func (m *Melody) BuildMelody(wr *writer.SMF) {
 	m.Phrases = make(map[uint8][]*Note, 0)
-	relativePosition, nextRelativePosition := 0., 0.
+	m.grooved = 0
+	measureTicks := m.TimeSignature.MeasureTicks(wr)
+	measure := uint8(1)
+	var relativePosition, nextRelativePosition uint32
 	for _, n := range m.Notes {
-		measure, _ := m.CurrentMeasure(wr)
-
 		relativePosition = nextRelativePosition
-		nextRelativePosition += m.TimeSignature.GetTicksOfDuration(n.Duration, wr)
+		nextRelativePosition += n.Duration.Ticks(wr)
 
 		fmt.Println("Measure", measure, "Metric", nextRelativePosition, "Pos", nextRelativePosition)
 
+		if m.Ties && nextRelativePosition > measureTicks {
+			end := nextRelativePosition
+			nextRelativePosition = m.TieOverBarline(wr, n, measure, measureTicks-relativePosition)
+			measure += uint8(end / measureTicks)
+			continue
+		}
+
 		// let's groove
-		if nextRelativePosition > float64(m.TimeSignature.Numerator) {
-			remainingTicks := float64(m.TimeSignature.Numerator) - relativePosition
-			grooveRest := &Note{
-				Duration: Quaver,
-				Note:     Rest,
-				Velocity: 100,
-				Tone:     5,
+		for nextRelativePosition > measureTicks {
+			fitted, gap := fitDurations(measureTicks-relativePosition, wr)
+			if gap > 0 {
+				m.SilenceTicks(wr, gap)
 			}
-			switch remainingTicks {
-			case 0.25:
-				n.Duration = Semiquaver
-			case 0.5:
-				n.Duration = Quaver
-			case 0.75:
-				grooveRest.Duration = Quaver
-				m.Phrases[measure] = append(m.Phrases[measure], grooveRest)
-				grooveRest.Play(wr)
 
-				n.Duration = Semiquaver
-			case 1:
-				n.Duration = Crochtet
-			case 1.5:
-				grooveRest.Duration = Quaver
-				m.Phrases[measure] = append(m.Phrases[measure], grooveRest)
-				grooveRest.Play(wr)
+			if len(fitted) == 0 {
+				// no room left for the note, it opens the next measure instead
+				measure++
+				relativePosition = 0
+				nextRelativePosition = n.Duration.Ticks(wr)
+				continue
+			}
 
-				n.Duration = Crochtet
+			for _, d := range fitted[:len(fitted)-1] {
+				grooveRest := &Note{
+					Duration: d,
+					Note:     Rest,
+					Velocity: 100,
+					Tone:     5,
+				}
+				m.Phrases[measure] = append(m.Phrases[measure], grooveRest)
+				m.play(wr, grooveRest)
 			}
-			nextRelativePosition = 0
+			n.Duration = fitted[len(fitted)-1]
+			nextRelativePosition = measureTicks
 		}
 
-		if nextRelativePosition == relativePosition {
+		m.play(wr, n)
+
+		m.Phrases[measure] = append(m.Phrases[measure], n)
+
+		if nextRelativePosition == measureTicks {
 			nextRelativePosition = 0
+			measure++
 		}
+	}
 
-		n.Play(wr)
+	m.release(wr)
+	if m.Swell {
+		writer.ControlChange(wr, ccExpression, 127)
+	}
 
-		m.Phrases[measure] = append(m.Phrases[measure], n)
+	m.Measures = measure
+	if nextRelativePosition == 0 {
+		m.Measures--
 	}
-	m.Measures, _ = m.CurrentMeasure(wr)
+}
+
+// play sounds the note in the groove, or only keeps its time when the melody is
+// silent
+func (m *Melody) play(wr *writer.SMF, n *Note) {
+	if m.Silent || n.Note == Rest {
+		m.release(wr)
+		m.SilenceTicks(wr, n.TiedTicks(wr))
+		return
+	}
+	if m.Swell {
+		m.swellPhrase(wr)
+	}
+	m.sound(wr, n, m.groove(n.TiedTicks(wr)))
 }
 
 func (m *Melody) Silence(wr *writer.SMF, d NoteDuration) {
-	n := &Note{
-		Duration: d,
-		Note:     Rest,
+	m.SilenceTicks(wr, d.Ticks(wr))
+}
+
+// TieOverBarline plays n tied over every barline it crosses, records the
+// pieces in the phrases of their measure and returns the position reached in
+// the last one. The ticks no duration can express rest in their own measure,
+// before the note in the first one so the tie still crosses the barline, after
+// the pieces in the others.
+func (m *Melody) TieOverBarline(wr *writer.SMF, n *Note, measure uint8, remaining uint32) uint32 {
+	measureTicks := m.TimeSignature.MeasureTicks(wr)
+	left := n.Duration.Ticks(wr)
+	n.Tie = nil
+
+	var head, last *Note
+	pieces := 0
+	span := remaining
+	for first := true; left > 0; first = false {
+		if span > left {
+			span = left
+		}
+
+		fitted, gap := fitDurations(span, wr)
+		if first && gap > 0 {
+			m.SilenceTicks(wr, gap)
+		}
+		for _, d := range fitted {
+			piece := n
+			if pieces > 0 {
+				piece = &Note{
+					Note:     n.Note,
+					Velocity: n.Velocity,
+					Tone:     n.Tone,
+					Tied:     last != nil,
+				}
+			}
+			if last != nil {
+				last.Tie = piece
+			}
+			if head == nil {
+				head = piece
+			}
+			piece.Duration = d
+			m.Phrases[measure] = append(m.Phrases[measure], piece)
+			last = piece
+			pieces++
+		}
+		if !first && gap > 0 {
+			// the rest breaks the tie, the next measure strikes the note again
+			if head != nil {
+				m.play(wr, head)
+			}
+			head, last = nil, nil
+			m.SilenceTicks(wr, gap)
+		}
+
+		left -= span
+		if left > 0 {
+			span = measureTicks
+			measure++
+		}
+	}
+	if head != nil {
+		m.play(wr, head)
+	}
+
+	if span == measureTicks {
+		return 0
 	}
-	n.Play(wr)
+	return span
+}
+
+// SilenceTicks rests for a length that no NoteDuration can express
+func (m *Melody) SilenceTicks(wr *writer.SMF, ticks uint32) {
+	m.forward(wr, m.groove(ticks))
+	wr.Silence(int8(wr.Channel()), true)
 }
 
 func countLinkedDuration(notes []*Note, d NoteDuration) int {
@@ -560,292 +970,332 @@ func countLinkedDuration(notes []*Note, d NoteDuration) int {
 	return next
 }
 func (m *Melody) BuildHarmony(wr *writer.SMF) {
+	if m.Progression == nil {
+		m.Harmonize(wr)
+	}
+
+	prevBass := m.Tonic() + 12*3
+	var prevVoicing []int32
+	m.chordVelocity = phraseVelocity + harmonyVelocity
+	m.grooved = 0
 	for i := uint8(1); i <= m.Measures; i++ {
 		if _, ok := m.Phrases[i]; !ok {
 			continue
 		}
 
-		n := m.Phrases[i][0]
-		d := Degree(I)
-		switch n.Note {
-		case m.Second():
-			d = II
-		case m.Third():
-			d = III
-		case m.Quarte():
-			d = IV
-		case m.Quinte():
-			d = V
-		case m.Sixte():
-			d = VI
-		case m.Seventh():
-			d = VII
-		}
-
-		nextMinim, nextQuaver, nextSemiquaver, nextCrochtet, nextCrochtetDot := 0, 0, 0, 0, 0
-		resetCountersExcept := func(d NoteDuration) {
-			switch d {
-			case Minim:
-				nextCrochtet, nextQuaver, nextSemiquaver, nextCrochtetDot = 0, 0, 0, 0
-			case Crochtet:
-				nextMinim, nextQuaver, nextSemiquaver, nextCrochtetDot = 0, 0, 0, 0
-			case Quaver:
-				nextMinim, nextCrochtet, nextSemiquaver, nextCrochtetDot = 0, 0, 0, 0
-			case Semiquaver:
-				nextMinim, nextQuaver, nextCrochtet, nextCrochtetDot = 0, 0, 0, 0
-			case CrochtetDot:
-				nextMinim, nextQuaver, nextSemiquaver, nextCrochtet = 0, 0, 0, 0
-			default:
-				nextMinim, nextCrochtetDot, nextCrochtet, nextQuaver, nextSemiquaver = 0, 0, 0, 0, 0
+		for slot, notes := range m.SplitHarmonicRhythm(wr, i) {
+			d := m.Progression[i][slot]
+			alt := m.AlterationFor(d, i)
+			if m.VoiceLeading {
+				alt = m.VoiceLead(d, alt, prevVoicing)
+				prevVoicing = m.Chord(d, alt, Crochtet).Tones()
+			} else if m.Inversions {
+				alt = m.Invert(d, alt, prevBass)
+				prevBass = m.Chord(d, alt, Crochtet).Notes[0].GetNoteTone()
 			}
-		}
-		for j, note := range m.Phrases[i] {
-			if note.Note == Rest {
-				resetCountersExcept(99) // reset all
-				switch note.Duration {
-				case Quaver:
-					m.BuildChord(wr, d, nil, Quaver)
-				case Crochtet:
-					fallthrough
-				default:
-					note.Play(wr)
+
+			for _, n := range notes {
+				if n.Note != Rest {
+					m.chordVelocity = n.Velocity + harmonyVelocity
+					break
 				}
-				continue
 			}
+			if m.Sustain {
+				m.lift(wr)
+			}
+			m.BuildChords(wr, notes, d, alt)
+		}
+	}
+	if m.Sustain {
+		writer.ControlChange(wr, ccSustain, 0)
+		m.lifted = false
+	}
+}
 
+// BuildChords plays the chord following the rhythm of the melody notes
+func (m *Melody) BuildChords(wr *writer.SMF, notes []*Note, d Degree, alt *ChordAlteration) {
+	nextMinim, nextQuaver, nextSemiquaver, nextCrochtet, nextCrochtetDot := 0, 0, 0, 0, 0
+	nextOther, otherDuration := 0, NoteDuration(0)
+	resetCountersExcept := func(d NoteDuration) {
+		if d != otherDuration {
+			nextOther = 0
+		}
+		switch d {
+		case Minim:
+			nextCrochtet, nextQuaver, nextSemiquaver, nextCrochtetDot = 0, 0, 0, 0
+		case Crochtet:
+			nextMinim, nextQuaver, nextSemiquaver, nextCrochtetDot = 0, 0, 0, 0
+		case Quaver:
+			nextMinim, nextCrochtet, nextSemiquaver, nextCrochtetDot = 0, 0, 0, 0
+		case Semiquaver:
+			nextMinim, nextQuaver, nextCrochtet, nextCrochtetDot = 0, 0, 0, 0
+		case CrochtetDot:
+			nextMinim, nextQuaver, nextSemiquaver, nextCrochtet = 0, 0, 0, 0
+		default:
+			nextMinim, nextCrochtetDot, nextCrochtet, nextQuaver, nextSemiquaver = 0, 0, 0, 0, 0
+		}
+	}
+	for j, note := range notes {
+		if note.Note == Rest {
+			resetCountersExcept(99) // reset all
 			switch note.Duration {
-			case Minim:
-				// m.BuildChord(wr, d, nil, Minim)
-				// resetCountersExcept(Minim)
-				// continue
-				if nextMinim > 0 {
-					continue
-				}
-				nextMinim = countLinkedDuration(m.Phrases[i][j:], Minim)
-				switch nextMinim {
-				case 1:
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Crochtet)
-					m.Silence(wr, Quaver)
-				case 2:
-					m.BuildChord(wr, d, nil, Minim)
-					m.Silence(wr, Crochtet)
-					m.BuildChord(wr, d, nil, Crochtet)
-				case 3: // out of measures but why not it's music yo, let happen what happens
-					// in the world of happy happenings
-					m.BuildChord(wr, d, nil, Minim)
-					m.Silence(wr, Minim)
-					m.BuildChord(wr, d, nil, Crochtet)
-					m.BuildChord(wr, d, nil, Crochtet)
-				}
-			case CrochtetDot:
-				// m.BuildChord(wr, d, nil, CrochtetDot)
-				// resetCountersExcept(CrochtetDot)
-				// continue
-				if nextCrochtetDot > 0 {
-					continue
-				}
-				nextCrochtetDot = countLinkedDuration(m.Phrases[i][j:], CrochtetDot)
-				switch nextCrochtetDot {
-				case 2:
-					m.Silence(wr, CrochtetDot)
-					m.BuildChord(wr, d, nil, Crochtet)
-					m.Silence(wr, Quaver)
-				case 3:
-					m.BuildChord(wr, d, nil, CrochtetDot)
-					m.BuildChord(wr, d, nil, Quaver)
-					m.Silence(wr, Crochtet)
-					m.BuildChord(wr, d, nil, CrochtetDot)
-				case 4:
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, CrochtetDot)
-					m.Silence(wr, CrochtetDot)
-					m.BuildChord(wr, d, nil, Crochtet)
-				case 5:
-					m.BuildChord(wr, d, nil, CrochtetDot)
-					m.BuildChord(wr, d, nil, CrochtetDot)
-					m.Silence(wr, CrochtetDot)
-					m.BuildChord(wr, d, nil, CrochtetDot)
-					m.Silence(wr, CrochtetDot)
-				default:
-					for nc := 1; nc <= nextCrochtetDot; nc++ {
-						m.BuildChord(wr, d, nil, CrochtetDot)
-					}
-				}
-			case Crochtet:
-				// m.BuildChord(wr, d, nil, Crochtet)
-				// resetCountersExcept(Crochtet)
-				// continue
-				if nextCrochtet > 0 {
-					continue
-				}
-				nextCrochtet = countLinkedDuration(m.Phrases[i][j:], Crochtet)
-				switch nextCrochtet {
-				case 2: // Minim
-					m.BuildChord(wr, d, nil, Minim)
-				case 3:
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Crochtet)
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Crochtet)
-				case 4: // 2 Minim
-					m.BuildChord(wr, d, nil, Minim)
-					m.Silence(wr, Crochtet)
-					m.BuildChord(wr, d, nil, Crochtet)
-				case 5: // 5 Crochet
-					m.BuildChord(wr, d, nil, Minim)
-					m.Silence(wr, Crochtet)
-					m.BuildChord(wr, d, nil, Crochtet)
-					m.Silence(wr, Crochtet)
-				default:
-					m.BuildChord(wr, d, nil, Crochtet)
-				}
 			case Quaver:
-				// m.BuildChord(wr, d, nil, Quaver)
-				// resetCountersExcept(Quaver)
-				// continue
-				if nextQuaver > 0 {
-					continue
-				}
-				nextQuaver = countLinkedDuration(m.Phrases[i][j:], Quaver)
-				switch nextQuaver {
-				case 1:
-					m.Silence(wr, Quaver)
-				case 2: // 1 Crochtet
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Quaver)
-				case 3:
-					m.BuildChord(wr, d, nil, CrochtetDot)
-				case 4: // 1 Minim
-					m.Silence(wr, Crochtet)
-					m.BuildChord(wr, d, nil, CrochtetDot)
-				case 5:
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Minim)
-				case 6: // 3 Crochtet
-					m.BuildChord(wr, d, nil, Crochtet)
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Crochtet)
-					m.Silence(wr, Quaver)
-				case 7: // 2 Minim (or 4 Crochtet)
-					m.BuildChord(wr, d, nil, Minim)
-					m.Silence(wr, Crochtet)
-					m.BuildChord(wr, d, nil, Crochtet)
-				case 8:
-					m.BuildChord(wr, d, nil, Minim)
-					m.Silence(wr, Crochtet)
-					m.BuildChord(wr, d, nil, CrochtetDot)
-				case 9: // 2 Minim + 1 Crochtet
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Crochtet)
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Crochtet)
-					m.BuildChord(wr, d, nil, Minim)
-				case 10:
-					m.BuildChord(wr, d, nil, Minim)
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Crochtet)
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Crochtet)
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Quaver)
-				}
-			case Semiquaver:
-				// m.BuildChord(wr, d, nil, Semiquaver)
-				// resetCountersExcept(Semiquaver)
-				// continue
-				if nextSemiquaver > 0 {
-					continue
-				}
-				nextSemiquaver = countLinkedDuration(m.Phrases[i][j:], Semiquaver)
-				switch nextSemiquaver {
-				case 1:
-					m.Silence(wr, Semiquaver)
-				case 2: // 1 Quaver
-					m.Silence(wr, Quaver)
-				case 3:
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Semiquaver)
-				case 4: // 1 Crochtet
-					m.BuildChord(wr, d, nil, Crochtet)
-				case 5:
-					m.Silence(wr, Semiquaver)
-					m.BuildChord(wr, d, nil, Crochtet)
-				case 6: // 1 Crochtet + 1 Quaver
-					m.Silence(wr, Crochtet)
-					m.BuildChord(wr, d, nil, Quaver)
-				case 7:
-					m.Silence(wr, Crochtet)
-					m.Silence(wr, Semiquaver)
-					m.BuildChord(wr, d, nil, Quaver)
-				case 8: // 2 Crochtet (ou 1 Minim)
-					m.BuildChord(wr, d, nil, Crochtet)
-					m.BuildChord(wr, d, nil, Crochtet)
-				case 9:
-					m.BuildChord(wr, d, nil, Crochtet)
-					m.Silence(wr, Semiquaver)
-					m.BuildChord(wr, d, nil, Crochtet)
-				case 10: // 1 Minim + 1 Quaver
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Minim)
-				case 11:
-					m.BuildChord(wr, d, nil, Minim)
-					m.Silence(wr, Semiquaver)
-					m.BuildChord(wr, d, nil, Quaver)
-				case 12: // 1 Minim + 1 Crochtet
-					m.BuildChord(wr, d, nil, Minim)
-					m.Silence(wr, Crochtet)
-				case 13:
-					m.BuildChord(wr, d, nil, Minim)
-					m.Silence(wr, Semiquaver)
-					m.BuildChord(wr, d, nil, Crochtet)
-				case 14: // 1 Minim + 1 Crochtet + 1 Quaver
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Quaver)
-					m.BuildChord(wr, d, nil, Quaver)
-					m.BuildChord(wr, d, nil, Minim)
-				case 15:
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Quaver)
-					m.Silence(wr, Semiquaver)
-					m.BuildChord(wr, d, nil, Quaver)
-					m.BuildChord(wr, d, nil, Minim)
-				case 16: // 2 Minim (or 4 Crochtet)
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Minim)
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Crochtet)
-				case 17:
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Minim)
-					m.Silence(wr, Quaver)
-					m.Silence(wr, Semiquaver)
-					m.BuildChord(wr, d, nil, Crochtet)
-				case 18: // 2 Minim + 1 Quaver
-					m.BuildChord(wr, d, nil, Minim)
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Crochtet)
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Quaver)
-				case 19:
-					m.Silence(wr, Semiquaver)
-					m.BuildChord(wr, d, nil, Minim)
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Crochtet)
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Quaver)
-				case 20: // 2 Minim + 1 Crochtet
-					m.BuildChord(wr, d, nil, Minim)
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Crochtet)
-					m.Silence(wr, Quaver)
-					m.BuildChord(wr, d, nil, Crochtet)
+				m.BuildChord(wr, d, alt, Quaver)
+			case Crochtet:
+				fallthrough
+			default:
+				m.SilenceTicks(wr, note.Duration.Ticks(wr))
+			}
+			continue
+		}
+
+		switch note.Duration {
+		case Minim:
+			// m.BuildChord(wr, d, nil, Minim)
+			// resetCountersExcept(Minim)
+			// continue
+			if nextMinim > 0 {
+				continue
+			}
+			nextMinim = countLinkedDuration(notes[j:], Minim)
+			switch nextMinim {
+			case 1:
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Crochtet)
+				m.Silence(wr, Quaver)
+			case 2:
+				m.BuildChord(wr, d, alt, Minim)
+				m.Silence(wr, Crochtet)
+				m.BuildChord(wr, d, alt, Crochtet)
+			case 3: // out of measures but why not it's music yo, let happen what happens
+				// in the world of happy happenings
+				m.BuildChord(wr, d, alt, Minim)
+				m.Silence(wr, Minim)
+				m.BuildChord(wr, d, alt, Crochtet)
+				m.BuildChord(wr, d, alt, Crochtet)
+			}
+		case CrochtetDot:
+			// m.BuildChord(wr, d, nil, CrochtetDot)
+			// resetCountersExcept(CrochtetDot)
+			// continue
+			if nextCrochtetDot > 0 {
+				continue
+			}
+			nextCrochtetDot = countLinkedDuration(notes[j:], CrochtetDot)
+			switch nextCrochtetDot {
+			case 2:
+				m.Silence(wr, CrochtetDot)
+				m.BuildChord(wr, d, alt, Crochtet)
+				m.Silence(wr, Quaver)
+			case 3:
+				m.BuildChord(wr, d, alt, CrochtetDot)
+				m.BuildChord(wr, d, alt, Quaver)
+				m.Silence(wr, Crochtet)
+				m.BuildChord(wr, d, alt, CrochtetDot)
+			case 4:
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, CrochtetDot)
+				m.Silence(wr, CrochtetDot)
+				m.BuildChord(wr, d, alt, Crochtet)
+			case 5:
+				m.BuildChord(wr, d, alt, CrochtetDot)
+				m.BuildChord(wr, d, alt, CrochtetDot)
+				m.Silence(wr, CrochtetDot)
+				m.BuildChord(wr, d, alt, CrochtetDot)
+				m.Silence(wr, CrochtetDot)
+			default:
+				for nc := 1; nc <= nextCrochtetDot; nc++ {
+					m.BuildChord(wr, d, alt, CrochtetDot)
 				}
 			}
-			resetCountersExcept(note.Duration)
+		case Crochtet:
+			// m.BuildChord(wr, d, nil, Crochtet)
+			// resetCountersExcept(Crochtet)
+			// continue
+			if nextCrochtet > 0 {
+				continue
+			}
+			nextCrochtet = countLinkedDuration(notes[j:], Crochtet)
+			switch nextCrochtet {
+			case 2: // Minim
+				m.BuildChord(wr, d, alt, Minim)
+			case 3:
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Crochtet)
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Crochtet)
+			case 4: // 2 Minim
+				m.BuildChord(wr, d, alt, Minim)
+				m.Silence(wr, Crochtet)
+				m.BuildChord(wr, d, alt, Crochtet)
+			case 5: // 5 Crochet
+				m.BuildChord(wr, d, alt, Minim)
+				m.Silence(wr, Crochtet)
+				m.BuildChord(wr, d, alt, Crochtet)
+				m.Silence(wr, Crochtet)
+			default:
+				m.BuildChord(wr, d, alt, Crochtet)
+			}
+		case Quaver:
+			// m.BuildChord(wr, d, nil, Quaver)
+			// resetCountersExcept(Quaver)
+			// continue
+			if nextQuaver > 0 {
+				continue
+			}
+			nextQuaver = countLinkedDuration(notes[j:], Quaver)
+			switch nextQuaver {
+			case 1:
+				m.Silence(wr, Quaver)
+			case 2: // 1 Crochtet
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Quaver)
+			case 3:
+				m.BuildChord(wr, d, alt, CrochtetDot)
+			case 4: // 1 Minim
+				m.Silence(wr, Crochtet)
+				m.BuildChord(wr, d, alt, CrochtetDot)
+			case 5:
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Minim)
+			case 6: // 3 Crochtet
+				m.BuildChord(wr, d, alt, Crochtet)
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Crochtet)
+				m.Silence(wr, Quaver)
+			case 7: // 2 Minim (or 4 Crochtet)
+				m.BuildChord(wr, d, alt, Minim)
+				m.Silence(wr, Crochtet)
+				m.BuildChord(wr, d, alt, Crochtet)
+			case 8:
+				m.BuildChord(wr, d, alt, Minim)
+				m.Silence(wr, Crochtet)
+				m.BuildChord(wr, d, alt, CrochtetDot)
+			case 9: // 2 Minim + 1 Crochtet
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Crochtet)
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Crochtet)
+				m.BuildChord(wr, d, alt, Minim)
+			case 10:
+				m.BuildChord(wr, d, alt, Minim)
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Crochtet)
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Crochtet)
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Quaver)
+			}
+		case Semiquaver:
+			// m.BuildChord(wr, d, nil, Semiquaver)
+			// resetCountersExcept(Semiquaver)
+			// continue
+			if nextSemiquaver > 0 {
+				continue
+			}
+			nextSemiquaver = countLinkedDuration(notes[j:], Semiquaver)
+			switch nextSemiquaver {
+			case 1:
+				m.Silence(wr, Semiquaver)
+			case 2: // 1 Quaver
+				m.Silence(wr, Quaver)
+			case 3:
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Semiquaver)
+			case 4: // 1 Crochtet
+				m.BuildChord(wr, d, alt, Crochtet)
+			case 5:
+				m.Silence(wr, Semiquaver)
+				m.BuildChord(wr, d, alt, Crochtet)
+			case 6: // 1 Crochtet + 1 Quaver
+				m.Silence(wr, Crochtet)
+				m.BuildChord(wr, d, alt, Quaver)
+			case 7:
+				m.Silence(wr, Crochtet)
+				m.Silence(wr, Semiquaver)
+				m.BuildChord(wr, d, alt, Quaver)
+			case 8: // 2 Crochtet (ou 1 Minim)
+				m.BuildChord(wr, d, alt, Crochtet)
+				m.BuildChord(wr, d, alt, Crochtet)
+			case 9:
+				m.BuildChord(wr, d, alt, Crochtet)
+				m.Silence(wr, Semiquaver)
+				m.BuildChord(wr, d, alt, Crochtet)
+			case 10: // 1 Minim + 1 Quaver
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Minim)
+			case 11:
+				m.BuildChord(wr, d, alt, Minim)
+				m.Silence(wr, Semiquaver)
+				m.BuildChord(wr, d, alt, Quaver)
+			case 12: // 1 Minim + 1 Crochtet
+				m.BuildChord(wr, d, alt, Minim)
+				m.Silence(wr, Crochtet)
+			case 13:
+				m.BuildChord(wr, d, alt, Minim)
+				m.Silence(wr, Semiquaver)
+				m.BuildChord(wr, d, alt, Crochtet)
+			case 14: // 1 Minim + 1 Crochtet + 1 Quaver
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Quaver)
+				m.BuildChord(wr, d, alt, Quaver)
+				m.BuildChord(wr, d, alt, Minim)
+			case 15:
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Quaver)
+				m.Silence(wr, Semiquaver)
+				m.BuildChord(wr, d, alt, Quaver)
+				m.BuildChord(wr, d, alt, Minim)
+			case 16: // 2 Minim (or 4 Crochtet)
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Minim)
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Crochtet)
+			case 17:
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Minim)
+				m.Silence(wr, Quaver)
+				m.Silence(wr, Semiquaver)
+				m.BuildChord(wr, d, alt, Crochtet)
+			case 18: // 2 Minim + 1 Quaver
+				m.BuildChord(wr, d, alt, Minim)
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Crochtet)
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Quaver)
+			case 19:
+				m.Silence(wr, Semiquaver)
+				m.BuildChord(wr, d, alt, Minim)
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Crochtet)
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Quaver)
+			case 20: // 2 Minim + 1 Crochtet
+				m.BuildChord(wr, d, alt, Minim)
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Crochtet)
+				m.Silence(wr, Quaver)
+				m.BuildChord(wr, d, alt, Crochtet)
+			}
+		default:
+			if nextOther > 0 && note.Duration == otherDuration {
+				continue
+			}
+			otherDuration = note.Duration
+			nextOther = countLinkedDuration(notes[j:], otherDuration)
+			// one chord over the whole run, split where no single duration fits
+			span, gap := fitDurations(uint32(nextOther)*otherDuration.Ticks(wr), wr)
+			for _, sd := range span {
+				m.BuildChord(wr, d, alt, sd)
+			}
+			if gap > 0 {
+				m.SilenceTicks(wr, gap)
+			}
 		}
+		resetCountersExcept(note.Duration)
 	}
 }
+
 func (m *Melody) CurrentMeasure(wr *writer.SMF) (uint8, uint64) {
 	tickPosition := wr.Position() / uint64(wr.MetricTicks.Resolution())
 	if tickPosition < uint64(m.TimeSignature.Numerator) {
@@ -859,66 +1309,81 @@ func (n *Note) GetNoteTone() int32 {
 }
 
 func main() {
-	err := writer.WriteSMF("./t.mid", 2, func(wr *writer.SMF) error {
-		//hash := "0ccccccccccc0" // 3/4 Minim
-		//hash := "0cccccccccc1" // 3/4 CrochtetDot
-		//hash := "0cccccccccc2" // 3/4 Crochtet
-		//hash := "0cccccccccccccc5" // 3/4 Semiquaver
-		//hash := "00ccccccccccc0" // 4/4 Minim
-		//hash := "00ccccccccccc1" // 4/4 CrochtetDot
-		//hash := "00ccccccccccc2" // 4/4 Crochtet
-		//hash := "00ccccccccccc3" // 4/4 Quaver
-		//hash := "00cccccccccccccccc3" // 4/4 Semiquaver
-		//hash := "000ccccccccccc0" // 5/4 Minim
-		//hash := "000cccccccccccccc1" // 5/4 CrochtetDot
-		//hash := "000cccccccccccccc2" // 5/4 Crochtet
-		//hash := "000ccccccccccccccccccc3" // 5/4 Quaver
-		//hash := "000cccccccccccccccccccccccc5" // 5/4 Semiquaver
-
-		hashes := []string{
-			"00000000000000000003efccdd987dd6d93ba18327eef8fd4b46d0de863eb14c",
-			"000000000000000000051f8864b8eddf483e7d2b941d626ecea1de70fa0bf551",
-			"0000000000000000000e760a04fc958a0631d47490b5f111d0d6aca418b9df17",
-			"00000000000000000011f9866ca32fbbbb3cfba26af498dcd98c0f013a920021",
-			"00000000000000000013f43456fe2e94a0760eaf779912e0fa37dfb64fe4ccdc",
-		}
-
-		wr.SetChannel(1) // sets the channel for the next messages
-		writer.TempoBPM(wr, 120)
-		writer.TrackSequenceName(wr, "title")
-		writer.Instrument(wr, "Lead")
-
-		melodies := make([]*Melody, 0)
+	//hash := "0ccccccccccc0" // 3/4 Minim
+	//hash := "0cccccccccc1" // 3/4 CrochtetDot
+	//hash := "0cccccccccc2" // 3/4 Crochtet
+	//hash := "0cccccccccccccc5" // 3/4 Semiquaver
+	//hash := "00ccccccccccc0" // 4/4 Minim
+	//hash := "00ccccccccccc1" // 4/4 CrochtetDot
+	//hash := "00ccccccccccc2" // 4/4 Crochtet
+	//hash := "00ccccccccccc3" // 4/4 Quaver
+	//hash := "00cccccccccccccccc3" // 4/4 Semiquaver
+	//hash := "000ccccccccccc0" // 5/4 Minim
+	//hash := "000cccccccccccccc1" // 5/4 CrochtetDot
+	//hash := "000cccccccccccccc2" // 5/4 Crochtet
+	//hash := "000ccccccccccccccccccc3" // 5/4 Quaver
+	//hash := "000cccccccccccccccccccccccc5" // 5/4 Semiquaver
+
+	hashes := []string{
+		"00000000000000000003efccdd987dd6d93ba18327eef8fd4b46d0de863eb14c",
+		"000000000000000000051f8864b8eddf483e7d2b941d626ecea1de70fa0bf551",
+		"0000000000000000000e760a04fc958a0631d47490b5f111d0d6aca418b9df17",
+		"00000000000000000011f9866ca32fbbbb3cfba26af498dcd98c0f013a920021",
+		"00000000000000000013f43456fe2e94a0760eaf779912e0fa37dfb64fe4ccdc",
+	}
 
-		for _, h := range hashes {
-			melodies = append(melodies, NewMelody(h))
-		}
+	profileName := flag.String("profile", "", "orchestration profile, one of "+strings.Join(ProfileNames(), ", ")+" or a JSON file")
+	flag.Parse()
 
-		for _, m := range melodies {
-			writer.Meter(wr, m.TimeSignature.Numerator, m.TimeSignature.Denominator)
-			m.BuildMelody(wr)
+	profile := DefaultProfile
+	if *profileName != "" {
+		var err error
+		if profile, err = LoadProfile(*profileName); err != nil {
+			fmt.Printf("could not load profile, error: %s", err)
+			return
 		}
-		writer.EndOfTrack(wr)
-
-		wr.SetChannel(2)
-		for _, m := range melodies {
-			m.BuildHarmony(wr)
-		}
-		writer.EndOfTrack(wr)
-
-		// wr.SetChannel(3)
-		// writer.Instrument(wr, "Bass")
-		// writer.EndOfTrack(wr)
-
-		// wr.SetChannel(4)
-		// writer.Instrument(wr, "Percussions")
-		// writer.EndOfTrack(wr)
+	}
 
-		return nil
-	})
+	// the song is prepared at the resolution of the file
+	wr := writer.NewSMF(io.Discard, 1)
+
+	themes := Themes(hashes)
+	for _, m := range themes {
+		m.Ties = true
+		m.ExtendedChords = true
+		m.Inversions = true
+		m.VoiceLeading = true
+		m.Functional = true
+		m.Develop()
+		m.Fold(profile.MelodyRange())
+		m.Cadence(wr, profile.MelodyRange())
+		m.Dynamics = true
+		m.ShapeDynamics(wr)
+		m.Articulate(wr)
+		m.Humanize = NewHumanizer(m.Hash, 24, 48, 8)
+		m.HarmonyHumanize = NewHumanizer(m.Hash, 12, 24, 6)
+		m.Groove = profile.GrooveFor(wr, m)
+		m.HarmonicRhythm = profile.Chords
+	}
 
+	song := NewSong(wr, themes)
+	a, err := profile.Arrange(wr, song, "title")
 	if err != nil {
+		fmt.Printf("could not arrange the song, error: %s", err)
+		return
+	}
+	if err := a.WriteFile("./t.mid"); err != nil {
 		fmt.Printf("could not write file, error: %s", err)
 		return
 	}
+
+	score, err := os.Create("./t.musicxml")
+	if err != nil {
+		fmt.Printf("could not write score, error: %s", err)
+		return
+	}
+	defer score.Close()
+	if err := song.WriteMusicXML(score, wr); err != nil {
+		fmt.Printf("could not write score, error: %s", err)
+	}
 }
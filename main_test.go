@@ -1,8 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"io"
 	"reflect"
 	"testing"
+
+	"gitlab.com/gomidi/midi"
+	"gitlab.com/gomidi/midi/midimessage/channel"
+	"gitlab.com/gomidi/midi/midimessage/meta"
+	"gitlab.com/gomidi/midi/reader"
+	"gitlab.com/gomidi/midi/writer"
 )
 
 func TestTimeSignature(t *testing.T) {
@@ -284,3 +292,224 @@ func TestBLocrianMode(t *testing.T) {
 		t.Errorf("B Locrian Seventh is expected to be A, got %d", m.Seventh())
 	}
 }
+
+func TestNoteDurationRatio(t *testing.T) {
+	want := map[NoteDuration][2]uint32{
+		Semibreve:            {1, 1},
+		MinimDot:             {3, 4},
+		Minim:                {1, 2},
+		CrochtetDot:          {3, 8},
+		Crochtet:             {1, 4},
+		QuaverDot:            {3, 16},
+		CrochtetTriplet:      {1, 6},
+		Quaver:               {1, 8},
+		QuaverTriplet:        {1, 12},
+		Semiquaver:           {1, 16},
+		SemiquaverQuintuplet: {1, 20},
+		SemiquaverTriplet:    {1, 24},
+		Demisemiquaver:       {1, 32},
+	}
+
+	for d, w := range want {
+		num, denom := d.Ratio()
+		if num != w[0] || denom != w[1] {
+			t.Errorf("Duration %d ratio unmatch, want %d/%d has %d/%d", d, w[0], w[1], num, denom)
+		}
+	}
+}
+
+func TestFitDurations(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+	beat := wr.MetricTicks.Ticks4th()
+
+	fitted, gap := fitDurations(beat*3/4, wr)
+	if !reflect.DeepEqual(fitted, []NoteDuration{QuaverDot}) || gap != 0 {
+		t.Errorf("Three semiquavers expected to fit a dotted quaver, got %v gap %d", fitted, gap)
+	}
+
+	fitted, gap = fitDurations(beat*2/3, wr)
+	if !reflect.DeepEqual(fitted, []NoteDuration{CrochtetTriplet}) || gap != 0 {
+		t.Errorf("Two triplet quavers expected to fit a triplet crochtet, got %v gap %d", fitted, gap)
+	}
+
+	fitted, gap = fitDurations(beat*5, wr)
+	if !reflect.DeepEqual(fitted, []NoteDuration{Semibreve, Crochtet}) || gap != 0 {
+		t.Errorf("Five crochtets expected to fit a semibreve and a crochtet, got %v gap %d", fitted, gap)
+	}
+}
+
+func TestTieOverBarline(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+	m := &Melody{
+		TimeSignature: &TimeSignature{Numerator: 2, Denominator: 4},
+		Phrases:       make(map[uint8][]*Note),
+	}
+	n := &Note{Note: C, Duration: Semibreve, Tone: 5}
+
+	position := m.TieOverBarline(wr, n, 1, wr.MetricTicks.Ticks4th())
+
+	if n.Duration != Crochtet {
+		t.Errorf("Tied note expected to keep a crochtet in its measure, got %d", n.Duration)
+	}
+	if n.Tie == nil || n.Tie.Duration != Minim || !n.Tie.Tied {
+		t.Fatalf("Tied note expected to continue on a minim, got %+v", n.Tie)
+	}
+	if n.Tie.Tie == nil || n.Tie.Tie.Duration != Crochtet {
+		t.Fatalf("Tied note expected to end on a crochtet, got %+v", n.Tie.Tie)
+	}
+	if !reflect.DeepEqual(m.Phrases[2], []*Note{n.Tie}) || !reflect.DeepEqual(m.Phrases[3], []*Note{n.Tie.Tie}) {
+		t.Errorf("Tied notes expected to be recorded in measures 2 and 3, got %+v", m.Phrases)
+	}
+	if n.TiedTicks(wr) != Semibreve.Ticks(wr) {
+		t.Errorf("Tied notes expected to last a semibreve, got %d ticks", n.TiedTicks(wr))
+	}
+	if position != wr.MetricTicks.Ticks4th() {
+		t.Errorf("Tied notes expected to end one crochtet into measure 3, got %d", position)
+	}
+}
+
+func TestTieOverBarlineKeepsGap(t *testing.T) {
+	var buf bytes.Buffer
+	wr := writer.NewSMF(&buf, 1)
+	m := &Melody{
+		TimeSignature: &TimeSignature{Numerator: 2, Denominator: 4},
+		Phrases:       make(map[uint8][]*Note),
+	}
+	n := &Note{Note: C, Duration: Minim, Tone: 5, Velocity: 100}
+	measureTicks := uint64(m.TimeSignature.MeasureTicks(wr))
+
+	// a septuplet remainder leaves no duration to fit on either side of the
+	// barline
+	remaining := uint64(wr.MetricTicks.Ticks4th() / 7)
+	m.TieOverBarline(wr, n, 1, uint32(remaining))
+	writer.EndOfTrack(wr)
+
+	ticks := func(notes []*Note) (sum uint64) {
+		for _, n := range notes {
+			sum += uint64(n.Duration.Ticks(wr))
+		}
+		return sum
+	}
+	first, second := ticks(m.Phrases[1]), ticks(m.Phrases[2])
+	if first == remaining || second == measureTicks-remaining {
+		t.Fatalf("Spans of %d and %d ticks expected to leave a gap in both measures", remaining, measureTicks-remaining)
+	}
+
+	var on, off, end []uint64
+	rd := reader.New(reader.NoLogger(), reader.Each(func(p *reader.Position, msg midi.Message) {
+		switch msg.(type) {
+		case channel.NoteOn:
+			on = append(on, p.AbsoluteTicks)
+		case channel.NoteOff:
+			off = append(off, p.AbsoluteTicks)
+		}
+		if msg == meta.EndOfTrack {
+			end = append(end, p.AbsoluteTicks)
+		}
+	}))
+	if err := reader.ReadSMF(rd, &buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first measure rests before the note, which ties over the barline
+	// and rests after it in the second
+	if want := []uint64{remaining - first}; !reflect.DeepEqual(on, want) {
+		t.Errorf("Tied note expected to start at %v, got %v", want, on)
+	}
+	if len(off) == 0 || off[0] != remaining+second {
+		t.Errorf("Tied note expected to end at %d, got %v", remaining+second, off)
+	}
+	if want := []uint64{measureTicks}; !reflect.DeepEqual(end, want) {
+		t.Errorf("Tied notes and gaps expected to last a minim to %v, got %v", want, end)
+	}
+}
+
+func TestCIonianChordAlterations(t *testing.T) {
+	m := NewMelody("cc00")
+	o := int32(36)
+
+	tests := []struct {
+		name string
+		d    Degree
+		alt  *ChordAlteration
+		want []int32
+	}{
+		{"IV", IV, nil, []int32{o + F, o + A, o + C + 12}},
+		{"VII", VII, nil, []int32{o + B, o + D + 12, o + F + 12}},
+		{"V7", V, &ChordAlteration{Dom: true}, []int32{o + G, o + B, o + D + 12, o + F + 12}},
+		{"Imaj7", I, &ChordAlteration{SevenMaj: true}, []int32{o + C, o + E, o + G, o + B}},
+		{"IIm11", II, &ChordAlteration{Eleven: true}, []int32{o + D, o + F, o + A, o + C + 12, o + E + 12, o + G + 12}},
+		{"V13", V, &ChordAlteration{Thirteenth: true}, []int32{o + G, o + B, o + D + 12, o + F + 12, o + A + 12, o + E + 24}},
+		{"V7b9", V, &ChordAlteration{NinthMin: true}, []int32{o + G, o + B, o + D + 12, o + F + 12, o + Ab + 12}},
+		{"VIIdim7", VII, &ChordAlteration{Dim: true, Seven: true}, []int32{o + B, o + D + 12, o + F + 12, o + Ab + 12}},
+		{"Iaug", I, &ChordAlteration{Aug: true}, []int32{o + C, o + E, o + Ab}},
+		{"IIm+5", II, &ChordAlteration{FifthAug: true}, []int32{o + D, o + F, o + Bb}},
+		{"Isus2", I, &ChordAlteration{Sus: true}, []int32{o + C, o + D, o + G}},
+		{"Vsus4", V, &ChordAlteration{SusFour: true}, []int32{o + G, o + C + 12, o + D + 12}},
+	}
+
+	for _, test := range tests {
+		got := m.Chord(test.d, test.alt, Crochtet).Tones()
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("C Ionian %s expected to be %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func TestChordTonesWrapOctave(t *testing.T) {
+	m := NewMelody("cc00")
+	o := int32(36)
+
+	c := m.Chord(II, &ChordAlteration{Dom: true}, Crochtet)
+	if want := []int32{o + D, o + Gb, o + A, o + C + 12}; !reflect.DeepEqual(c.Tones(), want) {
+		t.Errorf("C Ionian II7 expected to be %v, got %v", want, c.Tones())
+	}
+	for _, n := range c.Notes {
+		if n.Note == Rest {
+			t.Errorf("Chord tone %+v expected to wrap into the octave instead of reading as a rest", n)
+		}
+	}
+
+	bb := &Melody{Scale: Bb, Mode: Ionian}
+	c = bb.Chord(V, &ChordAlteration{Ninth: true, Eleven: true, Thirteenth: true}, Crochtet)
+	if want := []int32{o + F + 12, o + A + 12, o + C + 24, o + Eb + 24, o + G + 24, o + Bb + 24, o + D + 36}; !reflect.DeepEqual(c.Tones(), want) {
+		t.Errorf("Bb Ionian V13 expected to be %v, got %v", want, c.Tones())
+	}
+	for _, d := range []Degree{II, V, VII} {
+		for _, n := range bb.Chord(d, &ChordAlteration{Seven: true}, Crochtet).Notes {
+			if n.Note == Rest {
+				t.Errorf("Bb Ionian %d chord tone %+v expected to wrap into the octave instead of reading as a rest", d, n)
+			}
+		}
+	}
+}
+
+func TestCIonianChordInversions(t *testing.T) {
+	m := NewMelody("cc00")
+	o := int32(36)
+
+	tests := []struct {
+		name string
+		d    Degree
+		alt  *ChordAlteration
+		want []int32
+	}{
+		{"I6", I, &ChordAlteration{Reverse: 1}, []int32{o + E, o + G, o + C + 12}},
+		{"I64", I, &ChordAlteration{Reverse: 2}, []int32{o + G - 12, o + C, o + E}},
+		{"V42", V, &ChordAlteration{Dom: true, Reverse: 3}, []int32{o + F, o + G, o + B, o + D + 12}},
+		{"I/V", I, &ChordAlteration{SlashBass: true, Bass: V}, []int32{o + G - 12, o + C, o + E, o + G}},
+		{"IV/I", IV, &ChordAlteration{SlashBass: true, Bass: I}, []int32{o + C, o + F, o + A, o + C + 12}},
+	}
+
+	for _, test := range tests {
+		got := m.Chord(test.d, test.alt, Crochtet).Tones()
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("C Ionian %s expected to be %v, got %v", test.name, test.want, got)
+		}
+	}
+
+	alt := m.Invert(V, nil, o+C)
+	if bass := m.Chord(V, alt, Crochtet).Notes[0].GetNoteTone(); bass != o+D {
+		t.Errorf("C Ionian V after a C bass expected to stand on D, got %d", bass)
+	}
+}
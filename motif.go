@@ -0,0 +1,145 @@
+package main
+
+import (
+	"strings"
+)
+
+// Motif is a short figure of scale steps relative to its first note
+type Motif struct {
+	Steps     []int
+	Durations []NoteDuration
+}
+
+// Step returns the position of the note counted in scale steps
+func (m *Melody) Step(n *Note) int {
+	return int(m.DegreeOf(n)) + 7*int(n.Tone)
+}
+
+func (m *Melody) NoteAt(step int) (int32, int32) {
+	octave := step / 7
+	if step%7 < 0 {
+		octave--
+	}
+	note, _ := m.ScaleStep(step - 7*octave)
+	return note, int32(octave)
+}
+
+func (m *Melody) ExtractMotif(notes []*Note) *Motif {
+	motif := &Motif{}
+	for _, n := range notes {
+		motif.Steps = append(motif.Steps, m.Step(n)-m.Step(notes[0]))
+		motif.Durations = append(motif.Durations, n.Duration)
+	}
+	return motif
+}
+
+func (mo *Motif) Inversion() *Motif {
+	inverted := &Motif{Durations: mo.Durations}
+	for _, s := range mo.Steps {
+		inverted.Steps = append(inverted.Steps, -s)
+	}
+	return inverted
+}
+
+func (mo *Motif) Augmentation() *Motif {
+	augmented := &Motif{Steps: mo.Steps}
+	for _, d := range mo.Durations {
+		augmented.Durations = append(augmented.Durations, d.Augmented())
+	}
+	return augmented
+}
+
+// Augmented doubles the duration when a longer value exists
+func (d NoteDuration) Augmented() NoteDuration {
+	num, denom := d.Ratio()
+	for _, a := range durations {
+		if an, ad := a.Ratio(); an*denom == 2*num*ad {
+			return a
+		}
+	}
+	return d
+}
+
+// Realize plays the motif from the scale step given on the rhythm given, one
+// note per duration
+func (m *Melody) Realize(mo *Motif, from int, rhythm []NoteDuration) []*Note {
+	notes := make([]*Note, 0)
+	for i := 0; i < len(rhythm) && i < len(mo.Steps); i++ {
+		note, tone := m.NoteAt(from + mo.Steps[i])
+		notes = append(notes, &Note{
+			Note:     note,
+			Tone:     tone,
+			Velocity: 100,
+			Duration: rhythm[i],
+		})
+	}
+	return notes
+}
+
+// Rhythm returns the durations of the notes
+func Rhythm(notes []*Note) []NoteDuration {
+	rhythm := make([]NoteDuration, 0, len(notes))
+	for _, n := range notes {
+		rhythm = append(rhythm, n.Duration)
+	}
+	return rhythm
+}
+
+// straight tells whether no duration belongs to a tuplet group
+func straight(rhythm []NoteDuration) bool {
+	for _, d := range rhythm {
+		if d.TupletSize() > 1 {
+			return false
+		}
+	}
+	return true
+}
+
+// Develop turns the notes into a theme: the first notes become a motif that
+// the hash repeats, sequences, inverts or augments along the melody, leaving
+// some free material between
+func (m *Melody) Develop() {
+	hash := strings.TrimLeft(m.Hash, "0")
+	if len(hash) == 0 {
+		return
+	}
+
+	size := 3 + int(hash[0])%3
+	if len(m.Notes) < 2*size {
+		return
+	}
+
+	motif := m.ExtractMotif(m.Notes[:size])
+	origin := m.Step(m.Notes[0])
+
+	developed := append([]*Note{}, m.Notes[:size]...)
+	for i := size; i < len(m.Notes); i += size {
+		segment := m.Notes[i:]
+		if len(segment) > size {
+			segment = segment[:size]
+		}
+		from := m.Step(segment[0])
+		// the segment keeps its rhythm so its tuplet groups stay complete
+		rhythm := Rhythm(segment)
+
+		switch hash[i%len(hash)] {
+		case '0', '1', '2', '3':
+			developed = append(developed, m.Realize(motif, origin, rhythm)...)
+		case '4', '5', '6', '7':
+			developed = append(developed, m.Realize(motif, from, rhythm)...)
+		case '8', '9', 'a', 'b':
+			developed = append(developed, m.Realize(motif.Inversion(), from, rhythm)...)
+		case 'c', 'd':
+			// augmenting tuplets would leave their groups incomplete
+			if !straight(motif.Durations) || !straight(rhythm) {
+				developed = append(developed, m.Realize(motif, from, rhythm)...)
+				break
+			}
+			augmented := motif.Augmentation()
+			developed = append(developed, m.Realize(augmented, from, augmented.Durations[:len(segment)])...)
+		default:
+			developed = append(developed, segment...)
+		}
+	}
+	m.Notes = developed
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMotifTransformations(t *testing.T) {
+	m := NewMelody("cc00")
+	motif := m.ExtractMotif([]*Note{
+		{Note: C, Tone: 5, Duration: Quaver},
+		{Note: E, Tone: 5, Duration: Quaver},
+		{Note: D, Tone: 5, Duration: Crochtet},
+	})
+
+	if !reflect.DeepEqual(motif.Steps, []int{0, 2, 1}) {
+		t.Errorf("Motif steps expected to be [0 2 1], got %v", motif.Steps)
+	}
+	if inv := motif.Inversion(); !reflect.DeepEqual(inv.Steps, []int{0, -2, -1}) {
+		t.Errorf("Inversion steps expected to be [0 -2 -1], got %v", inv.Steps)
+	}
+	if aug := motif.Augmentation(); !reflect.DeepEqual(aug.Durations, []NoteDuration{Crochtet, Crochtet, Minim}) {
+		t.Errorf("Augmentation expected to double durations, got %v", aug.Durations)
+	}
+
+	// a sequence a third up, then the inversion crossing down the octave
+	tones := func(notes []*Note) []int32 {
+		t := make([]int32, 0)
+		for _, n := range notes {
+			t = append(t, n.GetNoteTone())
+		}
+		return t
+	}
+	if got := tones(m.Realize(motif, m.Step(&Note{Note: E, Tone: 5}), motif.Durations)); !reflect.DeepEqual(got, []int32{64, 67, 65}) {
+		t.Errorf("Sequence from E expected to be [64 67 65], got %v", got)
+	}
+	if got := tones(m.Realize(motif.Inversion(), m.Step(&Note{Note: C, Tone: 5}), motif.Durations)); !reflect.DeepEqual(got, []int32{60, 57, 59}) {
+		t.Errorf("Inversion from C expected to be [60 57 59], got %v", got)
+	}
+}
+
+func TestDevelopRepeatsMotif(t *testing.T) {
+	hash := "00000000000000000003efccdd987dd6d93ba18327eef8fd4b46d0de863eb14c"
+	m := NewMelody(hash)
+	notes := len(m.Notes)
+	m.Develop()
+
+	if len(m.Notes) != notes {
+		t.Fatalf("Developed melody expected to keep %d notes, got %d", notes, len(m.Notes))
+	}
+
+	// the first digit of the hash, 3, sets a motif of 3 notes
+	size := 3
+	motif := m.ExtractMotif(m.Notes[:size])
+	related := 0
+	for i := size; i+size <= len(m.Notes); i += size {
+		steps := m.ExtractMotif(m.Notes[i : i+size]).Steps
+		if reflect.DeepEqual(steps, motif.Steps) || reflect.DeepEqual(steps, motif.Inversion().Steps) {
+			related++
+		}
+	}
+	if related < len(m.Notes)/size/2 {
+		t.Errorf("Developed melody expected to restate its motif in most segments, got %d", related)
+	}
+}
+
+func TestDevelopKeepsTuplets(t *testing.T) {
+	hash := "00000000000000000003efccdd987dd6d93ba18327eef8fd4b46d0de863eb14c"
+	m := NewMelody(hash)
+	for _, n := range m.Notes {
+		n.Duration = QuaverTriplet
+	}
+	m.Develop()
+
+	for i, n := range m.Notes {
+		if n.Duration != QuaverTriplet {
+			t.Fatalf("Note %d expected to keep its triplet quaver, got %d", i, n.Duration)
+		}
+	}
+}
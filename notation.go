@@ -0,0 +1,276 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+type xmlScore struct {
+	XMLName xml.Name  `xml:"score-partwise"`
+	Version string    `xml:"version,attr"`
+	Parts   []xmlPart `xml:"part-list>score-part"`
+	Part    xmlPartBody
+}
+
+type xmlPart struct {
+	ID   string `xml:"id,attr"`
+	Name string `xml:"part-name"`
+}
+
+type xmlPartBody struct {
+	XMLName  xml.Name     `xml:"part"`
+	ID       string       `xml:"id,attr"`
+	Measures []xmlMeasure `xml:"measure"`
+}
+
+type xmlMeasure struct {
+	Number     int            `xml:"number,attr"`
+	Attributes *xmlAttributes `xml:"attributes,omitempty"`
+	Direction  *xmlDirection  `xml:"direction,omitempty"`
+	Notes      []xmlNote      `xml:"note"`
+}
+
+type xmlAttributes struct {
+	Divisions uint32 `xml:"divisions"`
+	Fifths    int32  `xml:"key>fifths"`
+	Beats     uint8  `xml:"time>beats"`
+	BeatType  uint8  `xml:"time>beat-type"`
+}
+
+type xmlDirection struct {
+	Words string `xml:"direction-type>words"`
+}
+
+type xmlNote struct {
+	Rest     *struct{}     `xml:"rest,omitempty"`
+	Pitch    *xmlPitch     `xml:"pitch,omitempty"`
+	Duration uint32        `xml:"duration"`
+	Tie      []xmlTie      `xml:"tie"`
+	Type     string        `xml:"type,omitempty"`
+	Dot      *struct{}     `xml:"dot,omitempty"`
+	Tuplet   *xmlTuplet    `xml:"time-modification,omitempty"`
+	Notation *xmlNotations `xml:"notations,omitempty"`
+}
+
+type xmlPitch struct {
+	Step   string `xml:"step"`
+	Alter  int32  `xml:"alter,omitempty"`
+	Octave int32  `xml:"octave"`
+}
+
+type xmlTie struct {
+	Type string `xml:"type,attr"`
+}
+
+type xmlTuplet struct {
+	Actual int `xml:"actual-notes"`
+	Normal int `xml:"normal-notes"`
+}
+
+type xmlNotations struct {
+	Tied         []xmlTie          `xml:"tied"`
+	Slur         []xmlTie          `xml:"slur"`
+	Articulation *xmlArticulations `xml:"articulations,omitempty"`
+}
+
+type xmlArticulations struct {
+	Staccato     *struct{} `xml:"staccato,omitempty"`
+	Tenuto       *struct{} `xml:"tenuto,omitempty"`
+	StrongAccent *struct{} `xml:"strong-accent,omitempty"`
+}
+
+// semitones of the relative major above the tonic of each mode
+var modeMajor = map[Mode]int32{Ionian: 0, Dorian: 10, Phrygian: 8, Lydian: 7, Mixolydian: 5, Aeolian: 3, Locrian: 1}
+
+// Fifths counts the sharps of the key signature, flats when negative
+func (m *Melody) Fifths() int32 {
+	major := (m.Scale + modeMajor[m.Mode]) % 12
+	fifths := major * 7 % 12
+	if fifths > 6 {
+		fifths -= 12
+	}
+	return fifths
+}
+
+func (m *Melody) pitch(n *Note) *xmlPitch {
+	steps := []string{"C", "C", "D", "D", "E", "F", "F", "G", "G", "A", "A", "B"}
+	alters := []int32{0, 1, 0, 1, 0, 0, 1, 0, 1, 0, 1, 0}
+	tone := n.GetNoteTone()
+	class := tone % 12
+	p := &xmlPitch{Step: steps[class], Alter: alters[class], Octave: tone/12 - 1}
+	if p.Alter != 0 && m.Fifths() < 0 {
+		p.Step = steps[(class+1)%12]
+		p.Alter = -1
+	}
+	return p
+}
+
+// notationType names the written value of the duration and the tuplet it
+// belongs to
+func notationType(d NoteDuration) (string, *xmlTuplet) {
+	types := map[NoteDuration]string{
+		Semibreve: "whole", Minim: "half", Crochtet: "quarter", Quaver: "eighth",
+		Semiquaver: "16th", Demisemiquaver: "32nd",
+		CrochtetTriplet: "quarter", QuaverTriplet: "eighth", SemiquaverTriplet: "16th",
+		SemiquaverQuintuplet: "16th",
+	}
+	base := d &^ Dotted
+	switch size := base.TupletSize(); size {
+	case 3:
+		return types[base], &xmlTuplet{Actual: 3, Normal: 2}
+	case 5:
+		return types[base], &xmlTuplet{Actual: 5, Normal: 4}
+	}
+	return types[base], nil
+}
+
+func (m *Melody) notate(wr *writer.SMF, n *Note, slurred bool) xmlNote {
+	x := xmlNote{Duration: n.Duration.Ticks(wr)}
+	x.Type, x.Tuplet = notationType(n.Duration)
+	if n.Duration&Dotted != 0 {
+		x.Dot = &struct{}{}
+	}
+	if n.Note == Rest {
+		x.Rest = &struct{}{}
+		return x
+	}
+	x.Pitch = m.pitch(n)
+
+	notations := &xmlNotations{}
+	if n.Tied {
+		x.Tie = append(x.Tie, xmlTie{"stop"})
+		notations.Tied = append(notations.Tied, xmlTie{"stop"})
+	}
+	if n.Tie != nil {
+		x.Tie = append(x.Tie, xmlTie{"start"})
+		notations.Tied = append(notations.Tied, xmlTie{"start"})
+	}
+	if slurred {
+		notations.Slur = append(notations.Slur, xmlTie{"stop"})
+	}
+	if n.Articulation == Legato && !n.Tied {
+		notations.Slur = append(notations.Slur, xmlTie{"start"})
+	}
+
+	switch {
+	case n.Tied:
+	case n.Articulation == Staccato:
+		notations.Articulation = &xmlArticulations{Staccato: &struct{}{}}
+	case n.Articulation == Tenuto:
+		notations.Articulation = &xmlArticulations{Tenuto: &struct{}{}}
+	case n.Articulation == Marcato:
+		notations.Articulation = &xmlArticulations{StrongAccent: &struct{}{}}
+	}
+	if len(notations.Tied) > 0 || len(notations.Slur) > 0 || notations.Articulation != nil {
+		x.Notation = notations
+	}
+	return x
+}
+
+func (m *Melody) attributes(wr *writer.SMF) *xmlAttributes {
+	return &xmlAttributes{
+		Divisions: wr.MetricTicks.Ticks4th(),
+		Fifths:    m.Fifths(),
+		Beats:     m.TimeSignature.Numerator,
+		BeatType:  m.TimeSignature.Denominator,
+	}
+}
+
+// notateHold notates a measure of the note held as Hold plays it
+func (m *Melody) notateHold(wr *writer.SMF, number int, note int32, tone int32) xmlMeasure {
+	measure := xmlMeasure{Number: number}
+	for n := m.Hold(wr, note, tone, 0); n != nil; n = n.Tie {
+		measure.Notes = append(measure.Notes, m.notate(wr, n, false))
+	}
+	return measure
+}
+
+// WriteMusicXML writes the melody of the sections as a MusicXML score, with
+// the ties and articulation marks of the notes, the held transitions and the
+// held tonic it ends on, measure for measure with the melody track. The melody
+// must have been built, its phrases hold the notes of every measure.
+func (s *Song) WriteMusicXML(w io.Writer, wr *writer.SMF) error {
+	score := xmlScore{
+		Version: "3.1",
+		Parts:   []xmlPart{{ID: "P1", Name: "Lead"}},
+		Part:    xmlPartBody{ID: "P1"},
+	}
+
+	number := 0
+	for k, section := range s.Sections {
+		m := section.Melody
+		// the transition is in the meter and key of the section it leads to
+		transition := 0
+		if k > 0 {
+			for _, top := range NewTransition(s.Sections[k-1].Melody, m).Tops() {
+				number++
+				measure := m.notateHold(wr, number, top%12, top/12)
+				if transition == 0 {
+					measure.Attributes = m.attributes(wr)
+				}
+				score.Part.Measures = append(score.Part.Measures, measure)
+				transition++
+			}
+		}
+
+		// the track rests until the section ends, past the last measure played
+		measureTicks := m.TimeSignature.MeasureTicks(wr)
+		measures := uint8((section.End - section.Start) / uint64(measureTicks))
+		if measures < m.Measures {
+			measures = m.Measures
+		}
+
+		slurred := false
+		for i := uint8(1); i <= measures; i++ {
+			number++
+			measure := xmlMeasure{Number: number}
+			if i == 1 {
+				if transition == 0 {
+					measure.Attributes = m.attributes(wr)
+				}
+				measure.Direction = &xmlDirection{Words: section.Name}
+			}
+
+			notes := m.Phrases[i]
+			if m.Silent || len(notes) == 0 {
+				notes = []*Note{{Note: Rest, Duration: Semibreve}}
+			}
+			played := uint32(0)
+			for _, n := range notes {
+				x := m.notate(wr, n, slurred && !n.Tied)
+				if m.Silent || len(m.Phrases[i]) == 0 {
+					x.Duration = measureTicks
+					x.Type = ""
+				}
+				measure.Notes = append(measure.Notes, x)
+				played += x.Duration
+				if !n.Tied {
+					slurred = n.Articulation == Legato
+				}
+			}
+			if played < measureTicks {
+				rest := xmlNote{Rest: &struct{}{}, Duration: measureTicks - played}
+				measure.Notes = append(measure.Notes, rest)
+			}
+			score.Part.Measures = append(score.Part.Measures, measure)
+		}
+	}
+	if len(s.Sections) > 0 {
+		last := s.Sections[len(s.Sections)-1].Melody
+		number++
+		score.Part.Measures = append(score.Part.Measures, last.notateHold(wr, number, last.Tonic(), last.FinalTone()))
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(score); err != nil {
+		return fmt.Errorf("could not write MusicXML: %w", err)
+	}
+	return nil
+}
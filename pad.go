@@ -0,0 +1,158 @@
+package main
+
+import (
+	"math"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+// expression the pad swells from and to
+const (
+	swellLow  = 40
+	swellHigh = 110
+)
+
+// PadTones voices the chord of the degree an octave above the harmony, or the
+// tonic, its fifth and its octave for a drone
+func (m *Melody) PadTones(d Degree, alt *ChordAlteration) []int32 {
+	if m.Drone {
+		tonic := m.Tonic() + 12*(4+m.Octaves)
+		return []int32{tonic, tonic + 7, tonic + 12}
+	}
+	tones := make([]int32, 0)
+	for _, tone := range m.Chord(d, alt, Crochtet).Tones() {
+		tones = append(tones, tone+12*(1+m.Octaves))
+	}
+	return tones
+}
+
+type padChord struct {
+	tones []int32
+	ticks uint32
+}
+
+// expression swells from its lowest to its highest halfway through the
+// period and back
+func expression(at, period uint32) uint8 {
+	return swellBetween(swellLow, swellHigh, at, period)
+}
+
+func swellBetween(low, high float64, at, period uint32) uint8 {
+	return uint8(low + (high-low)*math.Sin(math.Pi*float64(at%period)/float64(period)))
+}
+
+// playPad holds every chord for its ticks, the tones common to the next chord
+// sounding on, and swells over every period from the tick of the period given,
+// with a controller a crotchet
+func playPad(wr *writer.SMF, chords []padChord, velocity int32, period, at uint32) {
+	step := wr.MetricTicks.Ticks4th()
+	var sounding []int32
+	for _, c := range chords {
+		for _, tone := range sounding {
+			if !hasTone(c.tones, tone) {
+				writer.NoteOff(wr, uint8(tone))
+			}
+		}
+		for _, tone := range c.tones {
+			if !hasTone(sounding, tone) {
+				writer.NoteOn(wr, uint8(tone), uint8(velocity))
+			}
+		}
+		sounding = c.tones
+
+		for end := at + c.ticks; at < end; {
+			writer.ControlChange(wr, ccExpression, expression(at, period))
+			next := (at/step + 1) * step
+			if next > end {
+				next = end
+			}
+			writer.Forward(wr, 0, next-at, wr.MetricTicks.Ticks4th()*4)
+			at = next
+		}
+	}
+	for _, tone := range sounding {
+		writer.NoteOff(wr, uint8(tone))
+	}
+}
+
+func hasTone(tones []int32, tone int32) bool {
+	for _, t := range tones {
+		if t == tone {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Melody) padVelocity() int32 {
+	if m.Dynamics {
+		return m.HoldVelocity() + harmonyVelocity
+	}
+	return 80
+}
+
+// BuildPad holds the chords of the degrees the harmony is built on, a chord
+// lasting as long as it does not change
+func (m *Melody) BuildPad(wr *writer.SMF) {
+	if m.Progression == nil {
+		m.Harmonize(wr)
+	}
+
+	measureTicks := m.TimeSignature.MeasureTicks(wr)
+	chords := make([]padChord, 0)
+	for i := uint8(1); i <= m.Measures; i++ {
+		if _, ok := m.Phrases[i]; !ok {
+			continue
+		}
+		degrees := m.Progression[i]
+		for s, d := range degrees {
+			ticks := measureTicks*uint32(s+1)/uint32(len(degrees)) - measureTicks*uint32(s)/uint32(len(degrees))
+			tones := m.PadTones(d, m.AlterationFor(d, i))
+			if last := len(chords) - 1; last >= 0 && equalTones(chords[last].tones, tones) {
+				chords[last].ticks += ticks
+				continue
+			}
+			chords = append(chords, padChord{tones, ticks})
+		}
+	}
+	playPad(wr, chords, m.padVelocity(), phraseMeasures*measureTicks, 0)
+}
+
+func equalTones(a, b []int32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// BuildPad holds the chords of the transition a measure each
+func (t *Transition) BuildPad(wr *writer.SMF) {
+	measureTicks := t.To.TimeSignature.MeasureTicks(wr)
+	chords := make([]padChord, 0)
+	for _, voicing := range t.voicings() {
+		tones := make([]int32, 0)
+		for _, tone := range voicing {
+			tones = append(tones, tone+12*(1+t.To.Octaves))
+		}
+		if t.To.Drone {
+			tones = t.To.PadTones(I, nil)
+		}
+		chords = append(chords, padChord{tones, measureTicks})
+	}
+	playPad(wr, chords, t.To.padVelocity(), uint32(len(chords))*measureTicks, 0)
+}
+
+// BuildPad follows the sections of the melody track, ending on the tonic
+// chord of the last one
+func (s *Song) BuildPad(wr *writer.SMF) {
+	s.build(wr, (*Melody).BuildPad, (*Transition).BuildPad, func(last *Melody, wr *writer.SMF) {
+		// the last chord fades out
+		measureTicks := last.TimeSignature.MeasureTicks(wr)
+		playPad(wr, []padChord{{last.PadTones(I, nil), measureTicks}}, last.padVelocity(), 2*measureTicks, measureTicks)
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+func TestPadTones(t *testing.T) {
+	m := &Melody{Scale: D, Mode: Dorian}
+
+	if tones := m.PadTones(I, nil); !reflect.DeepEqual(tones, []int32{50, 53, 57}) {
+		t.Errorf("Pad expected to voice the tonic chord an octave above the harmony, got %v", tones)
+	}
+	m.Drone = true
+	if tones := m.PadTones(V, nil); !reflect.DeepEqual(tones, []int32{50, 57, 62}) {
+		t.Errorf("Drone expected on the tonic and its fifth whatever the degree, got %v", tones)
+	}
+}
+
+func TestExpressionSwells(t *testing.T) {
+	if low, high := expression(0, 3840), expression(1920, 3840); low != swellLow || high != swellHigh {
+		t.Errorf("Swell expected from %d to %d, got %d to %d", swellLow, swellHigh, low, high)
+	}
+	if a, b := expression(960, 3840), expression(2880, 3840); a != b {
+		t.Errorf("Swell expected to fall as it rose, got %d and %d", a, b)
+	}
+}
+
+func TestPlayPadKeepsLength(t *testing.T) {
+	var buf bytes.Buffer
+	wr := writer.NewSMF(&buf, 1)
+	crotchet := NoteDuration(Crochtet).Ticks(wr)
+
+	chords := []padChord{{[]int32{48, 52, 55}, 3 * crotchet}, {[]int32{48, 53, 57}, crotchet + crotchet/2}, {[]int32{47, 50, 55}, 2 * crotchet}}
+	playPad(wr, chords, 80, 8*crotchet, 0)
+	if want := uint64(6*crotchet + crotchet/2); wr.Position() != want {
+		t.Errorf("Pad expected to last %d ticks, got %d", want, wr.Position())
+	}
+}
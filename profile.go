@@ -0,0 +1,458 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gitlab.com/gomidi/midi/writer"
+)
+
+// directory the profiles are looked up in by name
+const profilesDir = "profiles"
+
+//go:embed profiles/*.json
+var profiles embed.FS
+
+// ProfilePart declares a part of the ensemble. The role tells what the part
+// plays, the style how it comps, hash or none letting the hash choose.
+type ProfilePart struct {
+	Name       string `json:"name"`
+	Role       string `json:"role"`                 // melody, harmony, counterpoint, doubling, bass, pad or drums
+	Instrument string `json:"instrument,omitempty"` // General MIDI instrument or drum kit, picked from the hash when missing
+	Channel    uint8  `json:"channel,omitempty"`    // from 1 to 16, allocated when missing
+	Low        int32  `json:"low,omitempty"`        // register of the melodic roles
+	High       int32  `json:"high,omitempty"`
+	Style      string `json:"style,omitempty"`
+
+	// automation, derived from the hash when missing
+	Pan     *uint8 `json:"pan,omitempty"`
+	Reverb  *uint8 `json:"reverb,omitempty"`
+	Chorus  *uint8 `json:"chorus,omitempty"`
+	Sustain *bool  `json:"sustain,omitempty"` // pedals the harmony
+	Swell   *bool  `json:"swell,omitempty"`   // swells the phrases of the melodic roles
+}
+
+// Profile orchestrates the song for an ensemble
+type Profile struct {
+	Name   string        `json:"name"`
+	Tempo  float64       `json:"tempo,omitempty"`
+	Groove string        `json:"groove,omitempty"` // straight, swing, shuffle or clave, picked from the hash when missing
+	Chords uint8         `json:"chords,omitempty"` // harmonic rhythm in chords per measure, one when missing
+	Parts  []ProfilePart `json:"parts"`
+}
+
+// DefaultProfile plays every part, instruments and styles from the hash
+var DefaultProfile = &Profile{
+	Name:  "default",
+	Tempo: 120,
+	Parts: []ProfilePart{
+		{Name: "Lead", Role: "melody"},
+		{Name: "Harmony", Role: "harmony"},
+		{Name: "Counterpoint", Role: "counterpoint"},
+		{Name: "Doubling", Role: "doubling"},
+		{Name: "Bass", Role: "bass"},
+		{Name: "Pad", Role: "pad"},
+		{Name: "Percussions", Role: "drums"},
+	},
+}
+
+// part of the instrument table and register each role defaults to
+var roleParts = map[string]string{
+	"melody":       "Lead",
+	"harmony":      "Harmony",
+	"counterpoint": "Counterpoint",
+	"doubling":     "Doubling",
+	"bass":         "Bass",
+	"pad":          "Pad",
+	"drums":        "Percussions",
+}
+
+// register of each role, the one harmony, bass and pad are written in unless
+// their part declares another
+var roleRanges = map[string]Range{
+	"melody":       InstrumentRanges["Lead"],
+	"harmony":      {36, 67},
+	"counterpoint": InstrumentRanges["Cello"],
+	"doubling":     InstrumentRanges["Clarinet"],
+	"bass":         InstrumentRanges["Bass"],
+	"pad":          {48, 79},
+}
+
+var arpeggioStyles = map[string]Arpeggio{
+	"block": Block, "up": Up, "down": Down, "up-down": UpDown, "alberti": Alberti, "broken": Broken,
+}
+
+var bassStyles = map[string]BassStyle{
+	"root": RootBass, "root-fifth": RootFifthBass, "walking": WalkingBass, "pedal": PedalBass,
+}
+
+var padStyles = map[string]bool{"chords": false, "drone": true}
+
+var doublingStyles = map[string]int{
+	"sixth-below": SixthBelow, "third-below": ThirdBelow, "third-above": ThirdAbove, "sixth-above": SixthAbove,
+}
+
+var grooveStyles = map[string]bool{"straight": true, "swing": true, "shuffle": true, "clave": true}
+
+// LoadProfile reads the profile from a JSON file, or from the profiles built
+// in when given a name
+func LoadProfile(name string) (*Profile, error) {
+	file := name
+	read := os.ReadFile
+	if filepath.Ext(name) != ".json" {
+		file = path.Join(profilesDir, name+".json")
+		read = profiles.ReadFile
+	}
+	data, err := read(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not read profile: %w", err)
+	}
+
+	// a misspelt key would otherwise leave its setting to the hash unnoticed
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	p := &Profile{}
+	if err := dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("could not parse profile %s: %w", file, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Validate checks the roles and styles of the parts are known and a single
+// part plays the melody, the other roles following its phrases
+func (p *Profile) Validate() error {
+	melodies := 0
+	for _, part := range p.Parts {
+		if part.Name == "" {
+			return fmt.Errorf("profile %s: a part has no name", p.Name)
+		}
+		if _, ok := roleParts[part.Role]; !ok {
+			return fmt.Errorf("profile %s: part %q has unknown role %q", p.Name, part.Name, part.Role)
+		}
+		if part.Role == "melody" {
+			melodies++
+		}
+		if part.Channel > midiChannels {
+			return fmt.Errorf("profile %s: part %q on channel %d, there are only %d", p.Name, part.Name, part.Channel, midiChannels)
+		}
+		if part.Low > part.High {
+			return fmt.Errorf("profile %s: part %q has its low note above its high one", p.Name, part.Name)
+		}
+		if part.Instrument != "" {
+			if _, err := GMPatch(part.Instrument); err != nil {
+				return fmt.Errorf("profile %s: %w", p.Name, err)
+			}
+		}
+		for _, cc := range []*uint8{part.Pan, part.Reverb, part.Chorus} {
+			if cc != nil && *cc > 127 {
+				return fmt.Errorf("profile %s: part %q has a controller above 127", p.Name, part.Name)
+			}
+		}
+		if !part.knownStyle() {
+			return fmt.Errorf("profile %s: part %q has unknown style %q", p.Name, part.Name, part.Style)
+		}
+		if part.Sustain != nil && part.Role != "harmony" {
+			return fmt.Errorf("profile %s: part %q cannot sustain, only the harmony pedals", p.Name, part.Name)
+		}
+		if part.High > 0 && part.Role == "drums" {
+			return fmt.Errorf("profile %s: part %q cannot have a register, the drums play their kit", p.Name, part.Name)
+		}
+		if part.Swell != nil && !swellRoles[part.Role] {
+			return fmt.Errorf("profile %s: part %q cannot swell, only the melodic roles do", p.Name, part.Name)
+		}
+	}
+	if melodies != 1 {
+		return fmt.Errorf("profile %s: %d parts play the melody, one is needed", p.Name, melodies)
+	}
+	if p.Groove != "" && p.Groove != "hash" && !grooveStyles[p.Groove] {
+		return fmt.Errorf("profile %s: unknown groove %q", p.Name, p.Groove)
+	}
+	if p.Chords > maxChordsPerMeasure {
+		return fmt.Errorf("profile %s: %d chords per measure, at most %d", p.Name, p.Chords, maxChordsPerMeasure)
+	}
+	return nil
+}
+
+// maxChordsPerMeasure keeps every chord of the harmonic rhythm a beat long at
+// least in common time
+const maxChordsPerMeasure = 4
+
+// swellRoles are the roles that shape their phrases with expression
+var swellRoles = map[string]bool{"melody": true, "counterpoint": true, "doubling": true}
+
+func (part ProfilePart) knownStyle() bool {
+	if part.Style == "" || part.Style == "hash" {
+		return true
+	}
+	var ok bool
+	switch part.Role {
+	case "harmony":
+		_, ok = arpeggioStyles[part.Style]
+	case "bass":
+		_, ok = bassStyles[part.Style]
+	case "pad":
+		_, ok = padStyles[part.Style]
+	case "doubling":
+		_, ok = doublingStyles[part.Style]
+	}
+	return ok
+}
+
+// Range is the register of the part, the one of its role when not declared
+func (part ProfilePart) Range() Range {
+	if part.High > 0 {
+		return Range{part.Low, part.High}
+	}
+	return roleRanges[part.Role]
+}
+
+// octaves is how far the part is moved from the register of its role to the
+// one it declares
+func (part ProfilePart) octaves() int32 {
+	if part.High == 0 {
+		return 0
+	}
+	role, declared := roleRanges[part.Role], part.Range()
+	return int32(math.Round(float64(declared.Low+declared.High-role.Low-role.High) / 24))
+}
+
+// MelodyRange is the register the melody is folded in
+func (p *Profile) MelodyRange() Range {
+	for _, part := range p.Parts {
+		if part.Role == "melody" {
+			return part.Range()
+		}
+	}
+	return roleRanges["melody"]
+}
+
+// GrooveFor is the groove of the profile, the one of the hash when not
+// declared
+func (p *Profile) GrooveFor(wr *writer.SMF, m *Melody) *Groove {
+	switch p.Groove {
+	case "straight":
+		return nil
+	case "swing":
+		return Swing(wr, 2./3)
+	case "shuffle":
+		return Shuffle(wr)
+	case "clave":
+		return Clave(wr, m.TimeSignature)
+	}
+	return GrooveFor(wr, m.Hash, m.TimeSignature)
+}
+
+// Arrange gives every part of the profile its instrument and channel, and the
+// track playing its role in the song. The melody comes first: building it
+// sets the phrases and progression the other parts follow.
+func (p *Profile) Arrange(wr *writer.SMF, song *Song, title string) (*Arrangement, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	tempo := p.Tempo
+	if tempo == 0 {
+		tempo = 120
+	}
+	a := NewArrangement(song, title, tempo)
+	if song.Instruments == nil {
+		song.Instruments = make(map[string]string)
+	}
+
+	reserved := map[uint8]bool{drumChannel: true}
+	for _, part := range p.Parts {
+		if part.Channel > 0 {
+			reserved[part.Channel-1] = true
+		}
+	}
+
+	parts := append([]ProfilePart{}, p.Parts...)
+	sort.SliceStable(parts, func(i, j int) bool {
+		return parts[i].Role == "melody" && parts[j].Role != "melody"
+	})
+	for i, part := range parts {
+		if err := p.instrument(song, part); err != nil {
+			return nil, err
+		}
+
+		build := p.build(wr, song, part)
+		var arranged *Part
+		var err error
+		switch {
+		case part.Role == "drums":
+			if part.Channel > 0 && part.Channel-1 != drumChannel {
+				return nil, fmt.Errorf("drum part %q on channel %d, drums play on %d", part.Name, part.Channel, drumChannel+1)
+			}
+			arranged, err = a.AddDrums(part.Name, build)
+		case part.Channel > 0:
+			arranged, err = a.Assign(part.Name, part.Channel-1, build)
+		default:
+			channel := uint8(0)
+			for reserved[channel] {
+				channel++
+			}
+			reserved[channel] = true
+			arranged, err = a.Assign(part.Name, channel, build)
+		}
+		if err != nil {
+			return nil, err
+		}
+		arranged.Mix = part.mix(song, i, len(parts))
+	}
+	return a, nil
+}
+
+// mix is the mix of the part, the controllers the profile leaves out derived
+// from the hash
+func (part ProfilePart) mix(song *Song, index, parts int) *Mix {
+	hash := ""
+	if len(song.Sections) > 0 {
+		hash = song.Sections[0].Melody.Hash
+	}
+	x := MixFor(hash, part.Role, index, parts)
+	if part.Pan != nil {
+		x.Pan = *part.Pan
+	}
+	if part.Reverb != nil {
+		x.Reverb = *part.Reverb
+	}
+	if part.Chorus != nil {
+		x.Chorus = *part.Chorus
+	}
+	return x
+}
+
+// sustain tells whether the harmony of the melody is pedalled
+func (part ProfilePart) sustain(m *Melody) bool {
+	if part.Sustain != nil {
+		return *part.Sustain
+	}
+	return SustainFor(m.Hash)
+}
+
+// swell tells whether the phrases of the melody swell
+func (part ProfilePart) swell(m *Melody) bool {
+	if part.Swell != nil {
+		return *part.Swell
+	}
+	return SwellFor(m.Hash)
+}
+
+// instrument records the instrument of the part, picked by the hash among the
+// ones of its role when the profile does not declare it
+func (p *Profile) instrument(song *Song, part ProfilePart) error {
+	if part.Instrument != "" {
+		song.Instruments[part.Name] = part.Instrument
+		return nil
+	}
+	patch, err := song.pickPatch(roleParts[part.Role])
+	if err != nil {
+		return err
+	}
+	song.Instruments[part.Name] = patch.Name
+	return nil
+}
+
+// build returns what writes the track of the part, setting its style on every
+// section first
+func (p *Profile) build(wr *writer.SMF, song *Song, part ProfilePart) func(wr *writer.SMF) error {
+	style := func(set func(m *Melody)) {
+		for _, section := range song.Sections {
+			set(section.Melody)
+		}
+	}
+
+	switch part.Role {
+	case "harmony":
+		return func(wr *writer.SMF) error {
+			style(func(m *Melody) {
+				m.Arpeggio = ArpeggioFor(m.Hash)
+				if a, ok := arpeggioStyles[part.Style]; ok {
+					m.Arpeggio = a
+				}
+				m.Sustain = part.sustain(m)
+				m.Octaves = part.octaves()
+			})
+			song.BuildHarmony(wr)
+			return nil
+		}
+	case "counterpoint":
+		voices := song.Voice(func(m *Melody) *Melody {
+			c := m.Counterpoint(wr, part.Range())
+			c.Humanize = NewHumanizer(m.Hash, 16, 48, 6)
+			c.Swell = part.swell(m)
+			return c
+		})
+		return func(wr *writer.SMF) error {
+			song.BuildVoice(wr, voices, part.Range().Low/12+1)
+			return nil
+		}
+	case "doubling":
+		voices := song.Voice(func(m *Melody) *Melody {
+			m.Doubling = DoublingFor(m.Hash)
+			if d, ok := doublingStyles[part.Style]; ok {
+				m.Doubling = d
+			}
+			d := m.Double(part.Range())
+			d.Humanize = NewHumanizer(m.Hash+"doubling", 16, 32, 6)
+			d.Swell = part.swell(m)
+			return d
+		})
+		return func(wr *writer.SMF) error {
+			song.BuildVoice(wr, voices, part.Range().Low/12+1)
+			return nil
+		}
+	case "bass":
+		return func(wr *writer.SMF) error {
+			style(func(m *Melody) {
+				m.BassStyle = BassStyleFor(m.Hash)
+				if s, ok := bassStyles[part.Style]; ok {
+					m.BassStyle = s
+				}
+				m.Octaves = part.octaves()
+			})
+			song.BuildBass(wr)
+			return nil
+		}
+	case "pad":
+		return func(wr *writer.SMF) error {
+			style(func(m *Melody) {
+				m.Drone = padStyles[part.Style]
+				m.Octaves = part.octaves()
+			})
+			song.BuildPad(wr)
+			return nil
+		}
+	case "drums":
+		return func(wr *writer.SMF) error {
+			song.BuildDrums(wr)
+			return nil
+		}
+	}
+	return func(wr *writer.SMF) error {
+		style(func(m *Melody) { m.Swell = part.swell(m) })
+		song.BuildMelody(wr)
+		return nil
+	}
+}
+
+// ProfileNames lists the profiles built in
+func ProfileNames() []string {
+	files, _ := fs.Glob(profiles, path.Join(profilesDir, "*.json"))
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, strings.TrimSuffix(path.Base(f), ".json"))
+	}
+	return names
+}
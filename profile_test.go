@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/gomidi/midi"
+	"gitlab.com/gomidi/midi/midimessage/channel"
+	"gitlab.com/gomidi/midi/midimessage/meta"
+	"gitlab.com/gomidi/midi/reader"
+	"gitlab.com/gomidi/midi/writer"
+)
+
+func TestLoadProfiles(t *testing.T) {
+	names := ProfileNames()
+	if len(names) < 5 {
+		t.Fatalf("Expected the five profiles, got %v", names)
+	}
+	for _, name := range names {
+		if _, err := LoadProfile(name); err != nil {
+			t.Errorf("Profile %s expected to load, got %v", name, err)
+		}
+	}
+	if _, err := LoadProfile("brass-band"); err == nil {
+		t.Errorf("Missing profile expected to fail")
+	}
+
+	file := filepath.Join(t.TempDir(), "typo.json")
+	data := `{"name": "typo", "parts": [{"name": "Lead", "role": "melody", "instrumnet": "Oboe"}]}`
+	if err := os.WriteFile(file, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadProfile(file); err == nil {
+		t.Errorf("Profile with a misspelt key expected to fail")
+	}
+}
+
+func TestProfileValidate(t *testing.T) {
+	on := true
+	for _, p := range []*Profile{
+		{Name: "role", Parts: []ProfilePart{{Name: "Kazoo", Role: "kazoo"}}},
+		{Name: "style", Parts: []ProfilePart{{Name: "Bass", Role: "bass", Style: "slap"}}},
+		{Name: "instrument", Parts: []ProfilePart{{Name: "Lead", Role: "melody", Instrument: "Theremin"}}},
+		{Name: "melodies", Parts: []ProfilePart{{Name: "A", Role: "melody"}, {Name: "B", Role: "melody"}}},
+		{Name: "channel", Parts: []ProfilePart{{Name: "Lead", Role: "melody", Channel: 17}}},
+		{Name: "groove", Groove: "polka", Parts: []ProfilePart{{Name: "Lead", Role: "melody"}}},
+		{Name: "melody", Parts: []ProfilePart{{Name: "Bass", Role: "bass"}}},
+		{Name: "sustain", Parts: []ProfilePart{{Name: "Lead", Role: "melody", Sustain: &on}}},
+		{Name: "swell", Parts: []ProfilePart{{Name: "Lead", Role: "melody"}, {Name: "Bass", Role: "bass", Swell: &on}}},
+		{Name: "chords", Chords: 5, Parts: []ProfilePart{{Name: "Lead", Role: "melody"}}},
+		{Name: "register", Parts: []ProfilePart{{Name: "Lead", Role: "melody"}, {Name: "Kit", Role: "drums", Low: 36, High: 60}}},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Profile with a bad %s expected to be invalid", p.Name)
+		}
+	}
+	if err := DefaultProfile.Validate(); err != nil {
+		t.Errorf("Default profile expected to be valid, got %v", err)
+	}
+}
+
+func TestProfileArrange(t *testing.T) {
+	wr := writer.NewSMF(io.Discard, 1)
+	song := NewSong(wr, Themes([]string{"00000000000000000003efccdd987dd6d93ba18327eef8fd4b46d0de863eb14c"}))
+
+	p := &Profile{Name: "trio", Parts: []ProfilePart{
+		{Name: "Piano", Role: "melody"},
+		{Name: "Left hand", Role: "harmony", Instrument: "Harpsichord", Channel: 1},
+		{Name: "Drums", Role: "drums"},
+		{Name: "Bass", Role: "bass", Style: "walking"},
+	}}
+	a, err := p.Arrange(wr, song, "title")
+	if err != nil {
+		t.Fatalf("Profile expected to arrange, got %v", err)
+	}
+
+	channels := map[string]uint8{"Piano": 1, "Left hand": 0, "Drums": drumChannel, "Bass": 2}
+	for _, part := range a.Parts {
+		if part.Channel != channels[part.Name] {
+			t.Errorf("%s expected on channel %d, got %d", part.Name, channels[part.Name], part.Channel)
+		}
+	}
+	if song.Instruments["Left hand"] != "Harpsichord" {
+		t.Errorf("Declared instrument expected to be kept, got %q", song.Instruments["Left hand"])
+	}
+	lead := false
+	for _, name := range partInstruments["Lead"] {
+		lead = lead || song.Instruments["Piano"] == name
+	}
+	if !lead {
+		t.Errorf("Melody without instrument expected one of the lead instruments, got %q", song.Instruments["Piano"])
+	}
+
+	// the instruments follow the role whatever the part is named
+	song = NewSong(wr, Themes([]string{"00000000000000000003efccdd987dd6d93ba18327eef8fd4b46d0de863eb14c"}))
+	named := &Profile{Name: "named", Parts: []ProfilePart{{Name: "Bass", Role: "melody"}, {Name: "Lead", Role: "bass"}}}
+	if _, err = named.Arrange(wr, song, "title"); err != nil {
+		t.Fatalf("Profile expected to arrange, got %v", err)
+	}
+	for part, role := range map[string]string{"Bass": "Lead", "Lead": "Bass"} {
+		found := false
+		for _, name := range partInstruments[role] {
+			found = found || song.Instruments[part] == name
+		}
+		if !found {
+			t.Errorf("Part %s expected one of the %s instruments, got %q", part, role, song.Instruments[part])
+		}
+	}
+
+	// the melody is built first so the harmony follows its phrases
+	song = NewSong(wr, Themes([]string{"00000000000000000003efccdd987dd6d93ba18327eef8fd4b46d0de863eb14c"}))
+	late := &Profile{Name: "late", Parts: []ProfilePart{{Name: "Harmony", Role: "harmony"}, {Name: "Lead", Role: "melody"}}}
+	if a, err = late.Arrange(wr, song, "title"); err != nil {
+		t.Fatalf("Profile expected to arrange, got %v", err)
+	}
+	if a.Parts[0].Name != "Lead" {
+		t.Fatalf("Melody expected to be the first track, got %s", a.Parts[0].Name)
+	}
+	for _, part := range a.Parts {
+		if err := part.Build(wr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if m := song.Sections[1].Melody; len(m.Progression) == 0 {
+		t.Errorf("Harmony expected to be built once the melody has its measures")
+	}
+
+	p.Parts = append(p.Parts, ProfilePart{Name: "Harp", Role: "harmony", Channel: 1})
+	if _, err := p.Arrange(wr, song, "title"); err == nil {
+		t.Errorf("Parts declared on one channel expected to collide")
+	}
+}
+
+func TestProfilePartRegisters(t *testing.T) {
+	viola := ProfilePart{Name: "Viola", Role: "harmony", Low: 48, High: 88}
+	if octaves := viola.octaves(); octaves != 1 {
+		t.Errorf("Harmony declared from 48 expected an octave up, got %d", octaves)
+	}
+	if octaves := (ProfilePart{Name: "Bass", Role: "bass", Low: 4, High: 31}).octaves(); octaves != -2 {
+		t.Errorf("Bass declared two octaves down expected to move so, got %d", octaves)
+	}
+	if octaves := (ProfilePart{Name: "Pad", Role: "pad"}).octaves(); octaves != 0 {
+		t.Errorf("Pad without a register expected to stay, got %d", octaves)
+	}
+
+	m := NewMelody("cc00")
+	bass, tones := m.BassTone(I), m.PadTones(V, nil)
+	m.Octaves = 1
+	if moved := m.BassTone(I); moved != bass+12 {
+		t.Errorf("Bass expected an octave up at %d, got %d", bass+12, moved)
+	}
+	for i, tone := range m.PadTones(V, nil) {
+		if tone != tones[i]+12 {
+			t.Errorf("Pad tone %d expected an octave up at %d, got %d", i, tones[i]+12, tone)
+		}
+	}
+}
+
+func TestProfileChords(t *testing.T) {
+	var buf bytes.Buffer
+	p := &Profile{Name: "changes", Chords: 2, Parts: []ProfilePart{
+		{Name: "Lead", Role: "melody"},
+		{Name: "Comping", Role: "harmony", Style: "block"},
+		{Name: "Bass", Role: "bass"},
+		{Name: "Pad", Role: "pad"},
+		{Name: "Drums", Role: "drums"},
+	}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Profile with two chords per measure expected to be valid, got %v", err)
+	}
+
+	wr := writer.NewSMF(&buf, 1)
+	themes := Themes([]string{"00000000000000000003efccdd987dd6d93ba18327eef8fd4b46d0de863eb14c"})
+	for _, m := range themes {
+		m.Functional = true
+		m.HarmonicRhythm = p.Chords
+	}
+	song := NewSong(wr, themes)
+	a, err := p.Arrange(wr, song, "title")
+	if err != nil {
+		t.Fatalf("Profile expected to arrange, got %v", err)
+	}
+	wr = writer.NewSMF(&buf, a.Tracks())
+	if err := a.Write(wr); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, section := range song.Sections {
+		for measure, degrees := range section.Melody.Progression {
+			if len(degrees) != 2 {
+				t.Errorf("Measure %d expected two chords, got %v", measure, degrees)
+			}
+		}
+	}
+
+	measureTicks := uint64(themes[0].TimeSignature.MeasureTicks(wr))
+	halves := 0
+	ends := map[uint64]bool{}
+	rd := reader.New(reader.NoLogger(), reader.Each(func(pos *reader.Position, msg midi.Message) {
+		if msg == meta.EndOfTrack {
+			ends[pos.AbsoluteTicks] = true
+		}
+		if on, ok := msg.(channel.NoteOn); ok && on.Velocity() > 0 && a.Parts[pos.Track-1].Name == "Comping" {
+			if pos.AbsoluteTicks%measureTicks == measureTicks/2 {
+				halves++
+			}
+		}
+	}))
+	if err := reader.ReadSMF(rd, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if halves == 0 {
+		t.Errorf("Harmony expected to change chords halfway through the measures")
+	}
+	if len(ends) != 1 {
+		t.Errorf("Tracks expected to end together, got %v", ends)
+	}
+}
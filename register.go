@@ -0,0 +1,109 @@
+package main
+
+// Range bounds the MIDI notes an instrument plays
+type Range struct {
+	Low  int32
+	High int32
+}
+
+var InstrumentRanges = map[string]Range{
+	"Lead":     {60, 84},
+	"Piano":    {21, 108},
+	"Voice":    {60, 81},
+	"Flute":    {60, 96},
+	"Violin":   {55, 103},
+	"Viola":    {48, 88},
+	"Cello":    {36, 76},
+	"Clarinet": {50, 94},
+	"Trumpet":  {54, 82},
+	"Guitar":   {40, 84},
+	"Bass":     {28, 55},
+}
+
+// intervals from a fourth up are leaps, to be recovered in the other direction
+const leapInterval = 5
+
+// Fold moves the notes of the melody by octaves so they stay in range. The
+// octave the hash gave is kept unless it leaps more than a fifth, and after a
+// leap the melody turns back.
+func (m *Melody) Fold(r Range) {
+	m.Register = r
+	var prev *Note
+	leap := int32(0)
+	for _, n := range m.Notes {
+		if n.Note == Rest {
+			continue
+		}
+
+		original := n.Tone
+		bestScore := int32(-1)
+		for tone := int32(-1); tone <= 10; tone++ {
+			pitch := n.Note + 12*tone
+			if pitch < r.Low || pitch > r.High {
+				continue
+			}
+
+			var score int32
+			if prev == nil {
+				score = abs(tone - original)
+			} else {
+				interval := pitch - prev.GetNoteTone()
+				score = abs(interval)
+				if tone != original {
+					score += 3
+				}
+				if (leap >= leapInterval && interval > 0) || (leap <= -leapInterval && interval < 0) {
+					score += 6
+				}
+			}
+
+			if bestScore < 0 || score < bestScore {
+				n.Tone, bestScore = tone, score
+			}
+		}
+
+		if prev != nil {
+			interval := n.GetNoteTone() - prev.GetNoteTone()
+			if (leap >= leapInterval && interval > 0) || (leap <= -leapInterval && interval < 0) {
+				m.StepBack(n, prev, leap)
+				interval = n.GetNoteTone() - prev.GetNoteTone()
+			}
+			leap = interval
+		}
+		prev = n
+	}
+}
+
+// InRegister moves the pitch by octaves into the register the melody was
+// folded into, from the fifth octave up when it was not
+func (m *Melody) InRegister(pitch int32) int32 {
+	r := m.Register
+	if r.High == 0 {
+		r = Range{60, 127}
+	}
+	for pitch < r.Low {
+		pitch += 12
+	}
+	for pitch > r.High && pitch-12 >= r.Low {
+		pitch -= 12
+	}
+	return pitch
+}
+
+// StepBack replaces n by the scale step next to prev, against the leap that
+// reached it
+func (m *Melody) StepBack(n, prev *Note, leap int32) {
+	step := int(m.DegreeOf(prev)) + 6
+	if leap < 0 {
+		step += 2
+	}
+	note, _ := m.ScaleStep(step)
+
+	n.Note = note
+	n.Tone = (prev.GetNoteTone() - note) / 12
+	if leap > 0 && n.GetNoteTone() >= prev.GetNoteTone() {
+		n.Tone--
+	} else if leap < 0 && n.GetNoteTone() <= prev.GetNoteTone() {
+		n.Tone++
+	}
+}
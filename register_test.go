@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestFoldKeepsRange(t *testing.T) {
+	r := InstrumentRanges["Voice"]
+	m := NewMelody("00000000000000000003efccdd987dd6d93ba18327eef8fd4b46d0de863eb14c")
+	m.Fold(r)
+
+	for i, n := range m.Notes {
+		if tone := n.GetNoteTone(); tone < r.Low || tone > r.High {
+			t.Errorf("Note %d expected to be folded in %v, got %d", i, r, tone)
+		}
+	}
+}
+
+func TestFoldRecoversLeaps(t *testing.T) {
+	m := NewMelody("cc00")
+	m.Notes = []*Note{
+		{Note: C, Tone: 5},
+		{Note: G, Tone: 5},
+		{Note: B, Tone: 5},
+		{Note: A, Tone: 6},
+		{Note: E, Tone: 5},
+		{Note: C, Tone: 5},
+	}
+	m.Fold(InstrumentRanges["Lead"])
+
+	want := []int32{60, 67, 65, 69, 64, 65}
+	for i, n := range m.Notes {
+		if n.GetNoteTone() != want[i] {
+			t.Errorf("Note %d expected to be %d, got %d", i, want[i], n.GetNoteTone())
+		}
+	}
+}
+
+func TestTransitionTopsInRegister(t *testing.T) {
+	r := Range{64, 96}
+	from, to := NewMelody("cc00"), &Melody{Scale: Eb, Mode: Ionian}
+	to.Fold(r)
+
+	for _, top := range NewTransition(from, to).Tops() {
+		if top < r.Low || top > r.High {
+			t.Errorf("Transition top %d expected in the register %v of the melody", top, r)
+		}
+	}
+	if pitch := NewMelody("cc00").InRegister(C); pitch != 60 {
+		t.Errorf("Pitch expected from the fifth octave up without a register, got %d", pitch)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"gitlab.com/gomidi/midi/writer"
+)
+
+type TransitionChord struct {
+	Key    *Melody // key the degree is read in
+	Degree Degree
+	Alt    *ChordAlteration
+}
+
+// Transition modulates from the key of a melody to the key of the next one,
+// one chord per measure in the meter of the next melody
+type Transition struct {
+	From   *Melody
+	To     *Melody
+	Chords []TransitionChord
+}
+
+func NewTransition(from, to *Melody) *Transition {
+	t := &Transition{From: from, To: to}
+	if from.Scale == to.Scale && from.Mode == to.Mode {
+		return t
+	}
+
+	dominant := TransitionChord{Key: to, Degree: V, Alt: &ChordAlteration{Dom: true}}
+
+	if pivot, ok := t.Pivot(); ok {
+		t.Chords = []TransitionChord{pivot, dominant}
+		return t
+	}
+
+	// a dominant seventh a semitone above the new tonic slides into it, the
+	// tritone substitute of its dominant
+	switch (to.Scale - from.Scale + 12) % 12 {
+	case 1, 6, 11:
+		tritone := &Melody{Scale: (to.Scale + 6) % 12, Mode: Ionian}
+		t.Chords = []TransitionChord{{Key: tritone, Degree: V, Alt: &ChordAlteration{Dom: true}}}
+		return t
+	}
+
+	secondary := &Melody{Scale: (to.Scale + 7) % 12, Mode: Ionian}
+	t.Chords = []TransitionChord{{Key: secondary, Degree: V, Alt: &ChordAlteration{Dom: true}}, dominant}
+	return t
+}
+
+// Pivot finds a chord both keys share, read in the new key, preferring the
+// ones leading to its dominant
+func (t *Transition) Pivot() (TransitionChord, bool) {
+	pitchClasses := func(m *Melody, d Degree) map[int32]bool {
+		classes := make(map[int32]bool)
+		for _, tone := range m.Chord(d, nil, Crochtet).Tones() {
+			classes[tone%12] = true
+		}
+		return classes
+	}
+
+	for _, d := range []Degree{II, IV, VI, III, I} {
+		to := pitchClasses(t.To, d)
+		for from := Degree(I); from <= VII; from++ {
+			shared := true
+			for class := range pitchClasses(t.From, from) {
+				shared = shared && to[class]
+			}
+			if shared {
+				return TransitionChord{Key: t.To, Degree: d}, true
+			}
+		}
+	}
+	return TransitionChord{}, false
+}
+
+func (t *Transition) voicings() [][]int32 {
+	voicings := make([][]int32, 0)
+	var prev []int32
+	for _, c := range t.Chords {
+		alt := c.Key.VoiceLead(c.Degree, c.Alt, prev)
+		prev = c.Key.Chord(c.Degree, alt, Crochtet).Tones()
+		voicings = append(voicings, prev)
+	}
+	return voicings
+}
+
+// Tops returns the top voice of every chord, moved into the register of the
+// melody
+func (t *Transition) Tops() []int32 {
+	tops := make([]int32, 0)
+	for _, voicing := range t.voicings() {
+		tops = append(tops, t.To.InRegister(voicing[len(voicing)-1]))
+	}
+	return tops
+}
+
+// BuildMelody holds the top voice of every chord in the melody register
+func (t *Transition) BuildMelody(wr *writer.SMF) {
+	for _, top := range t.Tops() {
+		t.To.Hold(wr, top%12, top/12, t.To.HoldVelocity()).Play(wr)
+	}
+}
+
+func (t *Transition) BuildHarmony(wr *writer.SMF) {
+	for _, voicing := range t.voicings() {
+		chord := &Chord{}
+		for _, tone := range voicing {
+			tone += 12 * t.To.Octaves
+			chord.Notes = append(chord.Notes, t.To.Hold(wr, tone%12, tone/12, 100))
+		}
+		if t.To.Dynamics {
+			chord.Balance(t.To.HoldVelocity() + harmonyVelocity)
+		}
+		chord.Play(wr)
+	}
+}
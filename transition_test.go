@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTransitionPivot(t *testing.T) {
+	from := &Melody{Scale: C, Mode: Ionian}
+	to := &Melody{Scale: G, Mode: Ionian}
+
+	tr := NewTransition(from, to)
+	if len(tr.Chords) != 2 {
+		t.Fatalf("C to G expected to modulate over two chords, got %d", len(tr.Chords))
+	}
+	if c := tr.Chords[0]; c.Key != to || c.Degree != II {
+		t.Errorf("C to G expected to pivot on A minor as II of G, got degree %d", c.Degree)
+	}
+	if c := tr.Chords[1]; c.Key != to || c.Degree != V || !c.Alt.Dom {
+		t.Errorf("C to G expected to reach the dominant seventh of G, got degree %d", c.Degree)
+	}
+}
+
+func TestTransitionChromaticLink(t *testing.T) {
+	from := &Melody{Scale: C, Mode: Ionian}
+	to := &Melody{Scale: Db, Mode: Ionian}
+
+	tr := NewTransition(from, to)
+	if len(tr.Chords) != 1 {
+		t.Fatalf("C to Db expected to slide over one chord, got %d", len(tr.Chords))
+	}
+	c := tr.Chords[0]
+	if root := c.Key.Chord(c.Degree, c.Alt, Crochtet).Notes[0].GetNoteTone() % 12; root != D {
+		t.Errorf("C to Db expected to slide from a D seventh, got root %d", root)
+	}
+}
+
+func TestTransitionSecondaryDominant(t *testing.T) {
+	from := &Melody{Scale: C, Mode: Ionian}
+	to := &Melody{Scale: C, Mode: Aeolian}
+
+	tr := NewTransition(from, to)
+	if len(tr.Chords) != 2 {
+		t.Fatalf("C Ionian to C Aeolian expected to modulate over two chords, got %d", len(tr.Chords))
+	}
+	c := tr.Chords[0]
+	if root := c.Key.Chord(c.Degree, c.Alt, Crochtet).Notes[0].GetNoteTone() % 12; root != D {
+		t.Errorf("C Ionian to C Aeolian expected to pass by the dominant of G, got root %d", root)
+	}
+
+	if same := NewTransition(from, &Melody{Scale: C, Mode: Ionian}); len(same.Chords) != 0 {
+		t.Errorf("Melodies in the same key expected to follow without transition")
+	}
+}
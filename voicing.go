@@ -0,0 +1,99 @@
+package main
+
+// lowest and highest tones a harmony voicing may reach, around the octave 3
+// chords are built in
+const (
+	voicingLow  int32 = 36
+	voicingHigh int32 = 67
+)
+
+// VoiceLead picks the inversion and octave of the chord that moves the voices
+// the least from the previous voicing, avoiding parallel fifths and octaves
+func (m *Melody) VoiceLead(d Degree, alt *ChordAlteration, prev []int32) *ChordAlteration {
+	if alt == nil {
+		alt = &ChordAlteration{}
+	}
+
+	var best ChordAlteration
+	bestScore := int32(-1)
+	for _, octave := range []int32{0, -1, 1} {
+		for k := uint8(0); k < uint8(len(m.Chord(d, alt, Crochtet).Notes)); k++ {
+			candidate := *alt
+			candidate.Reverse, candidate.Octave = k, octave
+
+			next := m.Chord(d, &candidate, Crochtet).Tones()
+			score := voiceMotion(prev, next) + 100*int32(parallels(prev, next))
+			for _, t := range next {
+				if t < voicingLow {
+					score += 10 * (voicingLow - t)
+				} else if t > voicingHigh {
+					score += 10 * (t - voicingHigh)
+				}
+			}
+
+			if bestScore < 0 || score < bestScore {
+				best, bestScore = candidate, score
+			}
+		}
+	}
+	return &best
+}
+
+// nearestVoice returns the previous tone a voice most likely moves from
+func nearestVoice(prev []int32, t int32) int32 {
+	nearest := prev[0]
+	for _, p := range prev[1:] {
+		if abs(t-p) < abs(t-nearest) {
+			nearest = p
+		}
+	}
+	return nearest
+}
+
+func voiceMotion(prev, next []int32) int32 {
+	if len(prev) == 0 {
+		return 0
+	}
+	motion := int32(0)
+	for _, t := range next {
+		motion += abs(t - nearestVoice(prev, t))
+	}
+	return motion
+}
+
+// parallels counts the pairs of voices moving in the same direction from a
+// fifth or an octave to the same interval
+func parallels(prev, next []int32) int {
+	if len(prev) == 0 {
+		return 0
+	}
+
+	from := make([]int32, len(next))
+	for i, t := range next {
+		from[i] = nearestVoice(prev, t)
+	}
+
+	count := 0
+	for i := range next {
+		for j := i + 1; j < len(next); j++ {
+			if from[i] == from[j] || from[i] == next[i] || from[j] == next[j] {
+				continue
+			}
+			if (next[i] > from[i]) != (next[j] > from[j]) {
+				continue
+			}
+			before, after := abs(from[j]-from[i])%12, abs(next[j]-next[i])%12
+			if before == after && (after == 0 || after == 7) {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func abs(v int32) int32 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
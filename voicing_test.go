@@ -0,0 +1,31 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVoiceLeadCIonian(t *testing.T) {
+	m := NewMelody("cc00")
+	prev := m.Chord(I, nil, Crochtet).Tones()
+
+	got := m.Chord(V, m.VoiceLead(V, nil, prev), Crochtet).Tones()
+	want := []int32{36 + D, 36 + G, 36 + B}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("C Ionian I to V expected to be voiced %v, got %v", want, got)
+	}
+
+	root := m.Chord(II, nil, Crochtet).Tones()
+	if parallels(prev, root) == 0 {
+		t.Fatalf("C Ionian I to II in root position expected to move in parallel fifths")
+	}
+	led := m.Chord(II, m.VoiceLead(II, nil, prev), Crochtet).Tones()
+	if parallels(prev, led) != 0 {
+		t.Errorf("C Ionian I to II expected to be voiced without parallels, got %v", led)
+	}
+	for _, tone := range led {
+		if tone < voicingLow || tone > voicingHigh {
+			t.Errorf("C Ionian I to II expected to stay in the harmony register, got %v", led)
+		}
+	}
+}